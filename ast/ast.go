@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"math/big"
 	"monkey/token"
 	"strings"
 )
@@ -9,6 +10,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Span() token.Span
 }
 
 type Statement interface {
@@ -27,6 +29,16 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Span() token.Span {
+	if len(p.Statements) == 0 {
+		return token.Span{}
+	}
+	return token.Span{
+		Start: p.Statements[0].Span().Start,
+		End:   p.Statements[len(p.Statements)-1].Span().End,
+	}
+}
+
 func (p *Program) String() string {
 	var out strings.Builder
 	for _, str := range p.Statements {
@@ -42,6 +54,12 @@ type LetStatement struct {
 }
 
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Span() token.Span {
+	if ls.Name == nil {
+		return ls.Token.Span
+	}
+	return spanOf(ls.Token, ls.Name, ls.Value)
+}
 func (ls *LetStatement) String() string {
 	return fmt.Sprintf("%s %s = %s;",
 		ls.TokenLiteral(),
@@ -56,10 +74,69 @@ type ReturnStatement struct {
 }
 
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Span() token.Span     { return spanOf(rs.Token, rs.ReturnValue) }
 func (rs *ReturnStatement) String() string {
 	return fmt.Sprintf("return %s;", rs.ReturnValue.String())
 }
 
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Span() token.Span {
+	if ws.Body == nil {
+		return spanOf(ws.Token, ws.Condition)
+	}
+	return spanOf(ws.Token, ws.Condition, ws.Body)
+}
+func (ws *WhileStatement) String() string {
+	return fmt.Sprintf("while %s %s", ws.Condition.String(), ws.Body.String())
+}
+
+// ForStatement loops over the elements of Iterable. Key is nil unless the
+// loop has two variables, as in "for (k, v in hash)".
+type ForStatement struct {
+	Token    token.Token
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Span() token.Span {
+	if fs.Body == nil {
+		return spanOf(fs.Token, fs.Iterable)
+	}
+	return spanOf(fs.Token, fs.Iterable, fs.Body)
+}
+func (fs *ForStatement) String() string {
+	variables := fs.Value.String()
+	if fs.Key != nil {
+		variables = fs.Key.String() + ", " + variables
+	}
+	return fmt.Sprintf("for (%s in %s) %s", variables, fs.Iterable.String(), fs.Body.String())
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Span() token.Span     { return bs.Token.Span }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Span() token.Span     { return cs.Token.Span }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -68,6 +145,15 @@ type IfExpression struct {
 }
 
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Span() token.Span {
+	if ie.Alternative != nil {
+		return spanOf(ie.Token, ie.Condition, ie.Alternative)
+	}
+	if ie.Consequence != nil {
+		return spanOf(ie.Token, ie.Condition, ie.Consequence)
+	}
+	return spanOf(ie.Token, ie.Condition)
+}
 func (ie *IfExpression) String() string {
 	out := fmt.Sprintf("if %s %s", ie.Condition.String(), ie.Consequence.String())
 	if ie.Alternative != nil {
@@ -78,11 +164,18 @@ func (ie *IfExpression) String() string {
 
 type FunctionLiteral struct {
 	Token      token.Token
+	Name       string
 	Parameters []*Identifier
 	Body       *BlockStatement
 }
 
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Span() token.Span {
+	if fl.Body == nil {
+		return fl.Token.Span
+	}
+	return spanOf(fl.Token, fl.Body)
+}
 func (fl *FunctionLiteral) String() string {
 	params := []string{}
 	for _, Identifier := range fl.Parameters {
@@ -95,9 +188,13 @@ func (fl *FunctionLiteral) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Token
 }
 
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Span() token.Span {
+	return closedSpanOf(bs.Token, bs.Rbrace)
+}
 func (bs *BlockStatement) String() string {
 	var out strings.Builder
 	for _, str := range bs.Statements {
@@ -112,6 +209,9 @@ type ExpressionStatement struct {
 }
 
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Span() token.Span {
+	return spanOf(es.Token, es.Expression)
+}
 func (es *ExpressionStatement) String() string {
 	return es.Expression.String()
 }
@@ -123,6 +223,7 @@ type PrefixExpression struct {
 }
 
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Span() token.Span     { return spanOf(pe.Token, pe.Right) }
 func (pe *PrefixExpression) String() string {
 	return fmt.Sprintf("(%s%s)", pe.Operator, pe.Right.String())
 }
@@ -135,16 +236,45 @@ type InfixExpression struct {
 }
 
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Span() token.Span {
+	span := spanOf(ie.Token, ie.Right)
+	if ie.Left != nil {
+		span.Start = ie.Left.Span().Start
+	}
+	return span
+}
 func (ie *InfixExpression) String() string {
 	return fmt.Sprintf("(%s %s %s)", ie.Left, ie.Operator, ie.Right.String())
 }
 
+// AssignExpression assigns Value to Target, which is an identifier or an
+// index expression. Operator is "=" or a compound operator such as "+=".
+type AssignExpression struct {
+	Token    token.Token
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Span() token.Span {
+	span := spanOf(ae.Token, ae.Value)
+	if ae.Target != nil {
+		span.Start = ae.Target.Span().Start
+	}
+	return span
+}
+func (ae *AssignExpression) String() string {
+	return fmt.Sprintf("(%s %s %s)", ae.Target, ae.Operator, ae.Value.String())
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
 }
 
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Span() token.Span     { return i.Token.Span }
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -156,6 +286,26 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
+func (il *IntegerLiteral) Span() token.Span     { return il.Token.Span }
+
+// BigIntegerLiteral is an integer literal with an n suffix.
+type BigIntegerLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+func (bl *BigIntegerLiteral) TokenLiteral() string { return bl.Token.Literal }
+func (bl *BigIntegerLiteral) String() string       { return bl.Token.Literal }
+func (bl *BigIntegerLiteral) Span() token.Span     { return bl.Token.Span }
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+func (fl *FloatLiteral) Span() token.Span     { return fl.Token.Span }
 
 type Boolean struct {
 	Token token.Token
@@ -164,14 +314,23 @@ type Boolean struct {
 
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 func (b *Boolean) String() string       { return b.Token.Literal }
+func (b *Boolean) Span() token.Span     { return b.Token.Span }
 
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Token
 }
 
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Span() token.Span {
+	span := closedSpanOf(ce.Token, ce.Rparen)
+	if ce.Function != nil {
+		span.Start = ce.Function.Span().Start
+	}
+	return span
+}
 func (ce *CallExpression) String() string {
 	args := []string{}
 	for _, arg := range ce.Arguments {
@@ -187,13 +346,41 @@ type StringLiteral struct {
 
 func (s *StringLiteral) TokenLiteral() string { return s.Token.Literal }
 func (s *StringLiteral) String() string { return s.Token.Literal }
+func (s *StringLiteral) Span() token.Span { return s.Token.Span }
+
+// InterpolatedString is a string literal with embedded expressions, such
+// as "Hello ${name}". Parts holds the text as string literals and the
+// expressions in between, in source order.
+type InterpolatedString struct {
+	Token token.Token // the first INTERPOLATION token
+	Parts []Expression
+	End   token.Token // the STRING token ending the literal
+}
+
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Span() token.Span     { return closedSpanOf(is.Token, is.End) }
+func (is *InterpolatedString) String() string {
+	var out strings.Builder
+	out.WriteString(`"`)
+	for _, part := range is.Parts {
+		if literal, ok := part.(*StringLiteral); ok {
+			out.WriteString(literal.Value)
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+	out.WriteString(`"`)
+	return out.String()
+}
 
 type ArrayLiteral struct {
-	Token token.Token
+	Token    token.Token
 	Elements []Expression
+	Rbracket token.Token
 }
 
 func (a *ArrayLiteral) TokenLiteral() string { return a.Token.Literal }
+func (a *ArrayLiteral) Span() token.Span     { return closedSpanOf(a.Token, a.Rbracket) }
 func (a *ArrayLiteral) String() string {
 	elements := make([]string, 0, len(a.Elements))
 	for _, element := range a.Elements {
@@ -203,26 +390,88 @@ func (a *ArrayLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token
-	Left Expression
-	Index Expression
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token
 }
 
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Span() token.Span {
+	span := closedSpanOf(ie.Token, ie.Rbracket)
+	if ie.Left != nil {
+		span.Start = ie.Left.Span().Start
+	}
+	return span
+}
 func (ie *IndexExpression) String() string { 
 	return fmt.Sprintf("(%s[%s])", ie.Left.String(), ie.Index.String())
 }
 
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token
+	Pairs  []HashPair // in source order
+	Rbrace token.Token
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
 }
 
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Span() token.Span     { return closedSpanOf(hl.Token, hl.Rbrace) }
 func (hl *HashLiteral) String() string { 
 	pairs := make([]string, 0, len(hl.Pairs))
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String() + ":" + value.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String() + ":" + pair.Value.String())
 	}
 	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
 }
+
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Span() token.Span {
+	if ml.Body == nil {
+		return ml.Token.Span
+	}
+	return spanOf(ml.Token, ml.Body)
+}
+func (ml *MacroLiteral) String() string {
+	params := []string{}
+	for _, identifier := range ml.Parameters {
+		params = append(params, identifier.String())
+	}
+
+	return fmt.Sprintf("macro (%s) %s", strings.Join(params, ", "), ml.Body.String())
+}
+
+// spanOf returns the span from the start of tok to the end of the last
+// node that is present.
+func spanOf(tok token.Token, nodes ...Node) token.Span {
+	span := tok.Span
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		if end := node.Span().End; end.IsValid() {
+			span.End = end
+		}
+	}
+	return span
+}
+
+// closedSpanOf returns the span from the start of open to the end of the
+// closing delimiter. If the delimiter is missing the span of open is used.
+func closedSpanOf(open token.Token, close token.Token) token.Span {
+	span := open.Span
+	if close.Span.End.IsValid() {
+		span.End = close.Span.End
+	}
+	return span
+}
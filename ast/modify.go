@@ -0,0 +1,205 @@
+package ast
+
+type ModifierFunc func(Node) Node
+
+// Modify walks the tree rooted at node depth first and replaces every node,
+// children before their parents, by the result of modifier. The tree passed
+// in is left unchanged, Modify returns a modified copy.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		program := *node
+		program.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&program)
+
+	case *LetStatement:
+		statement := *node
+		if node.Name != nil {
+			statement.Name, _ = Modify(node.Name, modifier).(*Identifier)
+		}
+		statement.Value = modifyExpression(node.Value, modifier)
+		return modifier(&statement)
+
+	case *ReturnStatement:
+		statement := *node
+		statement.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+		return modifier(&statement)
+
+	case *ExpressionStatement:
+		statement := *node
+		statement.Expression = modifyExpression(node.Expression, modifier)
+		return modifier(&statement)
+
+	case *WhileStatement:
+		statement := *node
+		statement.Condition = modifyExpression(node.Condition, modifier)
+		statement.Body = modifyBlock(node.Body, modifier)
+		return modifier(&statement)
+
+	case *ForStatement:
+		statement := *node
+		if node.Key != nil {
+			statement.Key, _ = Modify(node.Key, modifier).(*Identifier)
+		}
+		statement.Value, _ = Modify(node.Value, modifier).(*Identifier)
+		statement.Iterable = modifyExpression(node.Iterable, modifier)
+		statement.Body = modifyBlock(node.Body, modifier)
+		return modifier(&statement)
+
+	case *BreakStatement:
+		statement := *node
+		return modifier(&statement)
+
+	case *ContinueStatement:
+		statement := *node
+		return modifier(&statement)
+
+	case *BlockStatement:
+		block := *node
+		block.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&block)
+
+	case *IfExpression:
+		expression := *node
+		expression.Condition = modifyExpression(node.Condition, modifier)
+		expression.Consequence = modifyBlock(node.Consequence, modifier)
+		expression.Alternative = modifyBlock(node.Alternative, modifier)
+		return modifier(&expression)
+
+	case *FunctionLiteral:
+		literal := *node
+		literal.Parameters = modifyIdentifiers(node.Parameters, modifier)
+		literal.Body = modifyBlock(node.Body, modifier)
+		return modifier(&literal)
+
+	case *MacroLiteral:
+		literal := *node
+		literal.Parameters = modifyIdentifiers(node.Parameters, modifier)
+		literal.Body = modifyBlock(node.Body, modifier)
+		return modifier(&literal)
+
+	case *PrefixExpression:
+		expression := *node
+		expression.Right = modifyExpression(node.Right, modifier)
+		return modifier(&expression)
+
+	case *InfixExpression:
+		expression := *node
+		expression.Left = modifyExpression(node.Left, modifier)
+		expression.Right = modifyExpression(node.Right, modifier)
+		return modifier(&expression)
+
+	case *AssignExpression:
+		expression := *node
+		expression.Target = modifyExpression(node.Target, modifier)
+		expression.Value = modifyExpression(node.Value, modifier)
+		return modifier(&expression)
+
+	case *CallExpression:
+		expression := *node
+		expression.Function = modifyExpression(node.Function, modifier)
+		expression.Arguments = modifyExpressions(node.Arguments, modifier)
+		return modifier(&expression)
+
+	case *InterpolatedString:
+		literal := *node
+		literal.Parts = modifyExpressions(node.Parts, modifier)
+		return modifier(&literal)
+
+	case *ArrayLiteral:
+		literal := *node
+		literal.Elements = modifyExpressions(node.Elements, modifier)
+		return modifier(&literal)
+
+	case *IndexExpression:
+		expression := *node
+		expression.Left = modifyExpression(node.Left, modifier)
+		expression.Index = modifyExpression(node.Index, modifier)
+		return modifier(&expression)
+
+	case *HashLiteral:
+		literal := *node
+		literal.Pairs = make([]HashPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			literal.Pairs[i] = HashPair{
+				Key:   modifyExpression(pair.Key, modifier),
+				Value: modifyExpression(pair.Value, modifier),
+			}
+		}
+		return modifier(&literal)
+
+	case *Identifier:
+		identifier := *node
+		return modifier(&identifier)
+
+	case *IntegerLiteral:
+		literal := *node
+		return modifier(&literal)
+
+	case *BigIntegerLiteral:
+		literal := *node
+		return modifier(&literal)
+
+	case *FloatLiteral:
+		literal := *node
+		return modifier(&literal)
+
+	case *StringLiteral:
+		literal := *node
+		return modifier(&literal)
+
+	case *Boolean:
+		literal := *node
+		return modifier(&literal)
+	}
+
+	return modifier(node)
+}
+
+func modifyExpression(expression Expression, modifier ModifierFunc) Expression {
+	if expression == nil {
+		return nil
+	}
+	return Modify(expression, modifier)
+}
+
+func modifyExpressions(expressions []Expression, modifier ModifierFunc) []Expression {
+	if expressions == nil {
+		return nil
+	}
+	modified := make([]Expression, len(expressions))
+	for i, expression := range expressions {
+		modified[i] = modifyExpression(expression, modifier)
+	}
+	return modified
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) []Statement {
+	if statements == nil {
+		return nil
+	}
+	modified := make([]Statement, len(statements))
+	for i, statement := range statements {
+		modified[i] = Modify(statement, modifier)
+	}
+	return modified
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	modified, _ := Modify(block, modifier).(*BlockStatement)
+	return modified
+}
+
+func modifyIdentifiers(identifiers []*Identifier, modifier ModifierFunc) []*Identifier {
+	if identifiers == nil {
+		return nil
+	}
+	modified := make([]*Identifier, len(identifiers))
+	for i, identifier := range identifiers {
+		modified[i], _ = Modify(identifier, modifier).(*Identifier)
+	}
+	return modified
+}
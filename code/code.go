@@ -0,0 +1,304 @@
+package code
+
+import (
+	"encoding/binary"
+	"fmt"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out strings.Builder
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i += 1
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), len(def.OperandWidths))
+	}
+
+	switch len(operands) {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operand count for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpGreaterThan
+	OpLessEqual
+	OpGreaterEqual
+
+	OpMinus
+	OpBang
+	OpBitNot
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+	OpSetFree
+	OpCurrentClosure
+	OpAssignGlobal
+	OpGetLocalCell
+	OpGetFreeCell
+
+	OpArray
+	OpArrayExtend
+	OpHash
+	OpHashExtend
+	OpInterpolate
+	OpIndex
+	OpSetIndex
+	OpDup2
+
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+
+	OpQuote
+
+	OpIter
+	OpIterNext
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{4}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpShiftLeft:    {"OpShiftLeft", []int{}},
+	OpShiftRight:   {"OpShiftRight", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+
+	OpMinus:  {"OpMinus", []int{}},
+	OpBang:   {"OpBang", []int{}},
+	OpBitNot: {"OpBitNot", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpJump:          {"OpJump", []int{4}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{4}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{2}},
+	OpSetLocal:       {"OpSetLocal", []int{2}},
+	OpGetFree:        {"OpGetFree", []int{2}},
+	OpSetFree:        {"OpSetFree", []int{2}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	// like OpSetGlobal but fails if the global is not defined
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+
+	// push the cell holding a variable, to be captured by OpClosure
+	OpGetLocalCell: {"OpGetLocalCell", []int{2}},
+	OpGetFreeCell:  {"OpGetFreeCell", []int{2}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+
+	// add the values on top of the stack to the array or hash below them,
+	// for literals too large to build at once
+	OpArrayExtend: {"OpArrayExtend", []int{2}},
+	OpHashExtend:  {"OpHashExtend", []int{2}},
+
+	// number of parts of the string
+	OpInterpolate: {"OpInterpolate", []int{2}},
+
+	// pops the value, the index and the indexed object, pushes the value
+	OpSetIndex: {"OpSetIndex", []int{}},
+	// duplicates the two values on top of the stack
+	OpDup2: {"OpDup2", []int{}},
+
+	OpCall:        {"OpCall", []int{2}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	// constant index of the function, number of free variables
+	OpClosure: {"OpClosure", []int{4, 2}},
+
+	// constant index of the quote, number of unquoted values
+	OpQuote: {"OpQuote", []int{4, 2}},
+
+	OpIter: {"OpIter", []int{}},
+	// position to jump to when the iterator is done, number of values to
+	// push otherwise
+	OpIterNext: {"OpIterNext", []int{4, 1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// CheckOperands returns an error if an operand of op doesn't fit in its
+// width, in which case Make would truncate it.
+func CheckOperands(op Opcode, operands ...int) error {
+	def, err := Lookup(byte(op))
+	if err != nil {
+		return err
+	}
+
+	for i, operand := range operands {
+		if max := 1<<(8*def.OperandWidths[i]) - 1; operand < 0 || operand > max {
+			return fmt.Errorf("operand %d of %s out of range: %d, maximum is %d",
+				i, def.Name, operand, max)
+		}
+	}
+	return nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, width := range def.OperandWidths {
+		instructionLen += width
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, operand := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(operand))
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
+		case 1:
+			instruction[offset] = byte(operand)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// SourceMapping records that the instructions starting at Offset were
+// compiled from the code at Pos.
+type SourceMapping struct {
+	Offset int
+	Pos    token.Position
+}
+
+// SourceMap maps instruction offsets back to source positions. The
+// mappings are sorted by offset.
+type SourceMap []SourceMapping
+
+func (m SourceMap) Lookup(offset int) token.Position {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return m[i-1].Pos
+}
@@ -0,0 +1,727 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+	"strings"
+)
+
+// literalChunkSize is the most elements of an array or hash literal that
+// are pushed on the stack before they are added to it.
+const literalChunkSize = 256
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// position of the innermost node being compiled
+	pos token.Position
+
+	// first operand that didn't fit in its instruction, returned by Compile
+	err error
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	sourceMap           code.SourceMap
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	loops               []loop
+}
+
+// loop is a loop being compiled.
+type loop struct {
+	start  int   // position that continue jumps to
+	breaks []int // positions of the jumps of break, to be patched
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	SourceMap    code.SourceMap
+	Constants    []object.Object
+	GlobalNames  []string
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+	"<=": code.OpLessEqual,
+	">=": code.OpGreaterEqual,
+}
+
+var prefixOperators = map[string]code.Opcode{
+	"-": code.OpMinus,
+	"!": code.OpBang,
+	"~": code.OpBitNot,
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState returns a compiler that continues with the globals and
+// constants of an earlier compilation, as needed by the REPL.
+func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	outerPos := c.pos
+	if pos := node.Span().Start; pos.IsValid() {
+		c.pos = pos
+	}
+	defer func() { c.pos = outerPos }()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, statement := range node.Statements {
+			if err := c.Compile(statement); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			if err := c.Compile(statement); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		symbol := c.symbolTable.Define(node.Name.Value)
+		c.emitSet(symbol)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.WhileStatement:
+		start := len(c.currentInstructions())
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileLoopBody(start, node.Body); err != nil {
+			return err
+		}
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	case *ast.ForStatement:
+		if err := c.Compile(node.Iterable); err != nil {
+			return err
+		}
+		c.emit(code.OpIter)
+
+		// The iterator is kept in a variable whose name can't clash with
+		// an identifier. Nested loops need one each.
+		scope := &c.scopes[c.scopeIndex]
+		iterator := c.symbolTable.Define(fmt.Sprintf("<iterator %d>", len(scope.loops)))
+		c.emitSet(iterator)
+
+		start := len(c.currentInstructions())
+		c.emitGet(iterator)
+		numValues := 1
+		if node.Key != nil {
+			numValues = 2
+		}
+		iterNextPos := c.emit(code.OpIterNext, 9999, numValues)
+
+		c.emitSet(c.symbolTable.Define(node.Value.Value))
+		if node.Key != nil {
+			c.emitSet(c.symbolTable.Define(node.Key.Value))
+		}
+
+		if err := c.compileLoopBody(start, node.Body); err != nil {
+			return err
+		}
+		end := len(c.currentInstructions())
+		c.replaceInstruction(iterNextPos, c.make(code.OpIterNext, end, numValues))
+
+	case *ast.BreakStatement:
+		scope := &c.scopes[c.scopeIndex]
+		if len(scope.loops) == 0 {
+			return fmt.Errorf("%s: break outside loop", c.pos)
+		}
+		current := &scope.loops[len(scope.loops)-1]
+		current.breaks = append(current.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		scope := &c.scopes[c.scopeIndex]
+		if len(scope.loops) == 0 {
+			return fmt.Errorf("%s: continue outside loop", c.pos)
+		}
+		c.emit(code.OpJump, scope.loops[len(scope.loops)-1].start)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			// The name may still be defined later on or be a builtin,
+			// which the VM checks when the instruction is executed.
+			symbol = c.symbolTable.global().Define(node.Value)
+		}
+		c.emitGet(symbol)
+
+	case *ast.AssignExpression:
+		return c.compileAssignment(node)
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.BigIntegerLiteral:
+		integer := &object.BigInt{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			if err := c.Compile(part); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpInterpolate, len(node.Parts))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		op, ok := prefixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("%s: unknown operator %s", c.pos, node.Operator)
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("%s: unknown operator %s", c.pos, node.Operator)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBlockValue(node.Consequence); err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else if err := c.compileBlockValue(node.Alternative); err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.ArrayLiteral:
+		err := c.compileInChunks(len(node.Elements), 1, code.OpArray, code.OpArrayExtend,
+			func(i int) error {
+				return c.Compile(node.Elements[i])
+			})
+		if err != nil {
+			return err
+		}
+
+	case *ast.HashLiteral:
+		err := c.compileInChunks(len(node.Pairs), 2, code.OpHash, code.OpHashExtend,
+			func(i int) error {
+				if err := c.Compile(node.Pairs[i].Key); err != nil {
+					return err
+				}
+				return c.Compile(node.Pairs[i].Value)
+			})
+		if err != nil {
+			return err
+		}
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		reassigned := node.Name != "" && assignsTo(node.Body, node.Name)
+		if reassigned {
+			// The body must see the variable of the let statement, as in
+			// the evaluator, so it is defined before the body captures it.
+			c.symbolTable.Define(node.Name)
+		}
+
+		c.enterScope()
+
+		if node.Name != "" && !reassigned {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
+
+		for _, param := range node.Parameters {
+			c.symbolTable.Define(param.Value)
+		}
+
+		if err := c.Compile(node.Body); err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		instructions, sourceMap := c.leaveScope()
+
+		for _, symbol := range freeSymbols {
+			c.emitGetCell(symbol)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Name:          node.Name,
+			Instructions:  instructions,
+			SourceMap:     sourceMap,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+		}
+		c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	case *ast.CallExpression:
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+			return c.compileQuote(node)
+		}
+
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, argument := range node.Arguments {
+			if err := c.Compile(argument); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.MacroLiteral:
+		return fmt.Errorf("%s: macros can only be defined by top level let statements", c.pos)
+
+	default:
+		return fmt.Errorf("%s: cannot compile %T", c.pos, node)
+	}
+
+	return c.err
+}
+
+// compileLogicalExpression compiles && and || so that the right operand
+// is skipped when the left one decides the result, which is a boolean.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	var falseJumps, endJumps []int
+
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	if node.Operator == "&&" {
+		falseJumps = append(falseJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	} else {
+		rightPos := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		c.changeOperand(rightPos, len(c.currentInstructions()))
+	}
+
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	falseJumps = append(falseJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	c.emit(code.OpTrue)
+	endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+	for _, pos := range falseJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.emit(code.OpFalse)
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileInChunks compiles the n elements of a literal in chunks of at
+// most literalChunkSize, so that large literals don't fill the stack. Each
+// element pushes width values. first builds the literal from the first
+// chunk and extend adds each later chunk to it.
+func (c *Compiler) compileInChunks(
+	n, width int,
+	first, extend code.Opcode,
+	compileElement func(i int) error,
+) error {
+	op := first
+	for start := 0; start == 0 || start < n; start += literalChunkSize {
+		end := min(start+literalChunkSize, n)
+		for i := start; i < end; i++ {
+			if err := compileElement(i); err != nil {
+				return err
+			}
+		}
+		c.emit(op, (end-start)*width)
+		op = extend
+	}
+	return nil
+}
+
+// compileAssignment compiles an assignment so that it leaves the assigned
+// value on the stack. A compound assignment reads the target before it
+// evaluates the value, like the evaluator does.
+func (c *Compiler) compileAssignment(node *ast.AssignExpression) error {
+	op, compound := infixOperators[strings.TrimSuffix(node.Operator, "=")]
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			symbol = c.symbolTable.global().Define(target.Value)
+		}
+
+		if compound {
+			c.emitGet(symbol)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		c.emitAssign(symbol)
+		c.emitGet(symbol)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+
+		if compound {
+			c.emit(code.OpDup2)
+			c.emit(code.OpIndex)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("%s: cannot assign to %s", c.pos, node.Target)
+	}
+
+	return nil
+}
+
+// compileQuote compiles the arguments of the unquote calls inside the
+// quoted node. The VM replaces the calls by their values.
+func (c *Compiler) compileQuote(call *ast.CallExpression) error {
+	if len(call.Arguments) != 1 {
+		return fmt.Errorf("%s: wrong number of arguments. got=%d, want=1",
+			c.pos, len(call.Arguments))
+	}
+
+	unquoted := []ast.Expression{}
+	ast.Modify(call.Arguments[0], func(node ast.Node) ast.Node {
+		if call, ok := node.(*ast.CallExpression); ok && isUnquoteCall(call) {
+			unquoted = append(unquoted, call.Arguments[0])
+		}
+		return node
+	})
+
+	for _, argument := range unquoted {
+		if err := c.Compile(argument); err != nil {
+			return err
+		}
+	}
+
+	quote := &object.Quote{Node: call.Arguments[0]}
+	c.emit(code.OpQuote, c.addConstant(quote), len(unquoted))
+	return nil
+}
+
+// assignsTo reports whether node contains an assignment to name.
+func assignsTo(node ast.Node, name string) bool {
+	found := false
+	ast.Modify(node, func(node ast.Node) ast.Node {
+		if assign, ok := node.(*ast.AssignExpression); ok {
+			if ident, ok := assign.Target.(*ast.Identifier); ok && ident.Value == name {
+				found = true
+			}
+		}
+		return node
+	})
+	return found
+}
+
+func isUnquoteCall(call *ast.CallExpression) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "unquote" && len(call.Arguments) == 1
+}
+
+// compileLoopBody compiles body followed by a jump back to start, which is
+// also where continue jumps to. Break jumps to the end of the body.
+func (c *Compiler) compileLoopBody(start int, body *ast.BlockStatement) error {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, loop{start: start})
+
+	if err := c.Compile(body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	scope = &c.scopes[c.scopeIndex]
+	current := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range current.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileBlockValue compiles the block of an if expression so that it
+// leaves its value on the stack.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	start := len(c.currentInstructions())
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if len(c.currentInstructions()) > start && c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.GlobalNames(),
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	instruction := c.make(op, operands...)
+	pos := c.addInstruction(instruction)
+	c.setLastInstruction(op, pos)
+	return pos
+}
+
+func (c *Compiler) emitGet(symbol Symbol) {
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, symbol.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// emitGetCell pushes the cell of the variable of symbol, to be captured by
+// a closure. The VM puts the closure itself in a new cell.
+func (c *Compiler) emitGetCell(symbol Symbol) {
+	switch symbol.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocalCell, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, symbol.Index)
+	default:
+		c.emitGet(symbol)
+	}
+}
+
+// emitAssign is like emitSet but for variables that must already be
+// defined.
+func (c *Compiler) emitAssign(symbol Symbol) {
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpAssignGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, symbol.Index)
+	}
+}
+
+func (c *Compiler) emitSet(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
+func (c *Compiler) addInstruction(instruction []byte) int {
+	scope := &c.scopes[c.scopeIndex]
+	pos := len(scope.instructions)
+
+	last := len(scope.sourceMap) - 1
+	if last < 0 || scope.sourceMap[last].Pos != c.pos {
+		scope.sourceMap = append(scope.sourceMap, code.SourceMapping{Offset: pos, Pos: c.pos})
+	}
+
+	scope.instructions = append(scope.instructions, instruction...)
+	return pos
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{Opcode: op, Position: pos}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	last := scope.lastInstruction.Position
+
+	scope.instructions = scope.instructions[:last]
+	for len(scope.sourceMap) > 0 && scope.sourceMap[len(scope.sourceMap)-1].Offset >= last {
+		scope.sourceMap = scope.sourceMap[:len(scope.sourceMap)-1]
+	}
+	scope.lastInstruction = scope.previousInstruction
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	last := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(last, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	copy(ins[pos:], newInstruction)
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.replaceInstruction(opPos, c.make(op, operand))
+}
+
+// make is like code.Make but records an error for operands that don't
+// fit, such as jumps in too much code or too many locals.
+func (c *Compiler) make(op code.Opcode, operands ...int) []byte {
+	if err := code.CheckOperands(op, operands...); err != nil && c.err == nil {
+		c.err = fmt.Errorf("%s: program too large: %w", c.pos, err)
+	}
+	return code.Make(op, operands...)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex += 1
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() (code.Instructions, code.SourceMap) {
+	scope := c.scopes[c.scopeIndex]
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex -= 1
+	c.symbolTable = c.symbolTable.Outer
+
+	return scope.instructions, scope.sourceMap
+}
@@ -0,0 +1,191 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"monkey/object"
+)
+
+// Overflow is the policy for integer arithmetic whose result doesn't fit in
+// an int64. The empty policy is OverflowWrap.
+type Overflow string
+
+const (
+	OverflowWrap    Overflow = "wrap"    // wrap around, as in Go
+	OverflowError   Overflow = "error"   // return an error
+	OverflowPromote Overflow = "promote" // return the exact result as an object.BigInt
+)
+
+// IsValid reports whether o is a known policy.
+func (o Overflow) IsValid() bool {
+	switch o {
+	case "", OverflowWrap, OverflowError, OverflowPromote:
+		return true
+	default:
+		return false
+	}
+}
+
+// evalIntegerArithmetic evaluates +, -, *, / and % on two integers. Shifts
+// are not covered by the overflow policy, they drop the bits shifted out.
+func evalIntegerArithmetic(
+	operator string,
+	left int64,
+	right int64,
+	overflow Overflow,
+) object.Object {
+	var result int64
+	var overflowed bool
+
+	switch operator {
+	case "+":
+		result = left + right
+		overflowed = (result > left) != (right > 0)
+	case "-":
+		result = left - right
+		overflowed = (result < left) != (right > 0)
+	case "*":
+		result = left * right
+		overflowed = left != 0 && (result/left != right || left == -1 && right == math.MinInt64)
+	case "/":
+		if right == 0 {
+			return newError("division by zero")
+		}
+		result = left / right
+		overflowed = left == math.MinInt64 && right == -1
+	case "%":
+		if right == 0 {
+			return newError("modulo by zero")
+		}
+		result = left % right
+	}
+
+	if !overflowed {
+		return &object.Integer{Value: result}
+	}
+
+	switch overflow {
+	case OverflowError:
+		return newError("integer overflow: %d %s %d", left, operator, right)
+	case OverflowPromote:
+		return &object.BigInt{Value: bigArithmetic(operator, big.NewInt(left), big.NewInt(right))}
+	default:
+		return &object.Integer{Value: result}
+	}
+}
+
+// evalIntegerNegation negates an integer, which overflows for the smallest
+// int64.
+func evalIntegerNegation(value int64, overflow Overflow) object.Object {
+	if value != math.MinInt64 {
+		return &object.Integer{Value: -value}
+	}
+
+	switch overflow {
+	case OverflowError:
+		return newError("integer overflow: -(%d)", value)
+	case OverflowPromote:
+		return &object.BigInt{Value: new(big.Int).Neg(big.NewInt(value))}
+	default:
+		return &object.Integer{Value: value}
+	}
+}
+
+// maxBigIntShift caps the count of left shifts of big integers, whose
+// result would otherwise take any amount of memory.
+const maxBigIntShift = 1 << 20
+
+// evalBigIntInfixExpression evaluates operations on two integers of which at
+// least one is an object.BigInt. The result is a big integer even if it
+// would fit in an int64.
+func evalBigIntInfixExpression(
+	operator string,
+	left object.Object,
+	right object.Object,
+) object.Object {
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+
+	switch operator {
+	case "+", "-", "*":
+		return &object.BigInt{Value: bigArithmetic(operator, leftVal, rightVal)}
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return &object.BigInt{Value: bigArithmetic(operator, leftVal, rightVal)}
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.BigInt{Value: bigArithmetic(operator, leftVal, rightVal)}
+	case "&":
+		return &object.BigInt{Value: new(big.Int).And(leftVal, rightVal)}
+	case "|":
+		return &object.BigInt{Value: new(big.Int).Or(leftVal, rightVal)}
+	case "^":
+		return &object.BigInt{Value: new(big.Int).Xor(leftVal, rightVal)}
+	case "<<":
+		if rightVal.Sign() < 0 {
+			return newError("negative shift count: %s", rightVal)
+		}
+		if rightVal.Cmp(big.NewInt(maxBigIntShift)) > 0 {
+			return newError("shift count too large: %s", rightVal)
+		}
+		return &object.BigInt{Value: new(big.Int).Lsh(leftVal, uint(rightVal.Int64()))}
+	case ">>":
+		if rightVal.Sign() < 0 {
+			return newError("negative shift count: %s", rightVal)
+		}
+		// Shifting out all bits leaves 0 or -1.
+		count := uint(leftVal.BitLen())
+		if rightVal.Cmp(big.NewInt(int64(count))) < 0 {
+			count = uint(rightVal.Int64())
+		}
+		return &object.BigInt{Value: new(big.Int).Rsh(leftVal, count)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError(
+			"unknown operator: %s %s %s",
+			left.Type(), operator, right.Type(),
+		)
+	}
+}
+
+// toBigInt converts an integer to a big integer.
+func toBigInt(obj object.Object) *big.Int {
+	if integer, ok := obj.(*object.Integer); ok {
+		return big.NewInt(integer.Value)
+	}
+	return obj.(*object.BigInt).Value
+}
+
+// bigArithmetic returns the result of +, -, *, / or % on two big integers.
+// Division truncates toward zero, as for int64.
+func bigArithmetic(operator string, left *big.Int, right *big.Int) *big.Int {
+	result := new(big.Int)
+	switch operator {
+	case "+":
+		result.Add(left, right)
+	case "-":
+		result.Sub(left, right)
+	case "*":
+		result.Mul(left, right)
+	case "/":
+		result.Quo(left, right)
+	case "%":
+		result.Rem(left, right)
+	}
+	return result
+}
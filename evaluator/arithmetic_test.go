@@ -0,0 +1,173 @@
+package evaluator_test
+
+import (
+	"context"
+	"math"
+	"monkey/evaluator"
+	"monkey/object"
+	"testing"
+)
+
+func TestDivisionByZero(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input           string
+			expectedMessage string
+		}{
+			{"1 / 0", "division by zero"},
+			{"let x = 0; 10 / x", "division by zero"},
+			{"1 % 0", "modulo by zero"},
+			{"let x = 5; x /= 0; x", "division by zero"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != tt.expectedMessage {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					tt.expectedMessage, errObj.Message)
+			}
+		}
+
+		testFloatObject(t, testEval("1.0 / 0"), math.Inf(1))
+	})
+}
+
+func TestOverflow(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			overflow evaluator.Overflow
+			expected interface{}
+		}{
+			{"9223372036854775807 + 1", "", int64(-9223372036854775808)},
+			{"9223372036854775807 + 1", evaluator.OverflowWrap, int64(-9223372036854775808)},
+			{"9223372036854775807 + 1", evaluator.OverflowError,
+				"integer overflow: 9223372036854775807 + 1"},
+			{"9223372036854775807 + 1", evaluator.OverflowPromote, "9223372036854775808"},
+			{"-9223372036854775807 - 2", evaluator.OverflowError,
+				"integer overflow: -9223372036854775807 - 2"},
+			{"-9223372036854775807 - 2", evaluator.OverflowPromote, "-9223372036854775809"},
+			{"4294967296 * 4294967296", evaluator.OverflowWrap, int64(0)},
+			{"4294967296 * 4294967296", evaluator.OverflowError,
+				"integer overflow: 4294967296 * 4294967296"},
+			{"4294967296 * 4294967296", evaluator.OverflowPromote, "18446744073709551616"},
+			{"let min = -9223372036854775807 - 1; min / -1", evaluator.OverflowError,
+				"integer overflow: -9223372036854775808 / -1"},
+			{"let min = -9223372036854775807 - 1; -1 * min", evaluator.OverflowPromote,
+				"9223372036854775808"},
+			{"let min = -9223372036854775807 - 1; -min", evaluator.OverflowError,
+				"integer overflow: -(-9223372036854775808)"},
+			{"let min = -9223372036854775807 - 1; -min", evaluator.OverflowPromote,
+				"9223372036854775808"},
+			{"let x = 9223372036854775807; x += 1; x", evaluator.OverflowPromote,
+				"9223372036854775808"},
+			{"9223372036854775806 + 1", evaluator.OverflowError, int64(9223372036854775807)},
+			{"-4611686018427387904 * 2", evaluator.OverflowError, int64(-9223372036854775808)},
+			{"let min = -9223372036854775807 - 1; min % -1", evaluator.OverflowError, int64(0)},
+			{"1 << 63 << 1", evaluator.OverflowError, int64(0)},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEvalWithConfig(context.Background(), tt.input,
+				evaluator.Config{Overflow: tt.overflow})
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, evaluated, expected)
+			case string:
+				switch result := evaluated.(type) {
+				case *object.BigInt:
+					if tt.overflow != evaluator.OverflowPromote || result.Inspect() != expected {
+						t.Errorf("wrong result for %q. want=%s, got=%s",
+							tt.input, expected, result.Inspect())
+					}
+				case *object.Error:
+					if tt.overflow != evaluator.OverflowError || result.Message != expected {
+						t.Errorf("wrong error for %q. want=%q, got=%q",
+							tt.input, expected, result.Message)
+					}
+				default:
+					t.Errorf("wrong result for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				}
+			}
+		}
+	})
+}
+
+func TestBigIntegers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"10n", "10"},
+			{"123456789012345678901234567890n + 1", "123456789012345678901234567891"},
+			{"9223372036854775807n + 1", "9223372036854775808"},
+			{"2n * 3", "6"},
+			{"-7n / 2", "-3"},
+			{"-7n % 2", "-1"},
+			{"-5n", "-5"},
+			{"~5n", "-6"},
+			{"0xFFn & 0x0F", "15"},
+			{"1n << 100", "1267650600228229401496703205376"},
+			{"(1n << 100) >> 98", "4"},
+			{"-1n >> 1000000000000", "-1"},
+			{
+				"let fact = fn(n) { if (n < 2) { 1n } else { n * fact(n - 1) } }; fact(30)",
+				"265252859812191058636308480000000",
+			},
+			{"5n == 5", true},
+			{"5 != 5n", false},
+			{"10000000000000000000n > 9223372036854775807", true},
+			{"-10000000000000000000n < -9223372036854775807", true},
+			{"3n <= 2", false},
+			{"1n / 0", "division by zero"},
+			{"1n % 0n", "modulo by zero"},
+			{"1n << -1", "negative shift count: -1"},
+			{"1n << 10000000", "shift count too large: 10000000"},
+			{"1n + true", "type mismatch: BIGINT + BOOLEAN"},
+			{`{5: "five"}[5n]`, "five"},
+			{`{10000000000000000000n: "big"}[10000000000000000000n]`, "big"},
+			{"int(42n)", int64(42)},
+			{"int(10000000000000000000n)", "bigint 10000000000000000000 out of integer range"},
+			{"float(10000000000000000000n)", 1e19},
+			{"1n + 0.5", 1.5},
+			{`"${12345678901234567890n}"`, "12345678901234567890"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, evaluated, expected)
+			case float64:
+				testFloatObject(t, evaluated, expected)
+			case bool:
+				testBooleanObject(t, evaluated, expected)
+			case string:
+				switch result := evaluated.(type) {
+				case *object.BigInt, *object.String:
+					if result.Inspect() != expected {
+						t.Errorf("wrong result for %q. want=%s, got=%s",
+							tt.input, expected, result.Inspect())
+					}
+				case *object.Error:
+					if result.Message != expected {
+						t.Errorf("wrong error for %q. want=%q, got=%q",
+							tt.input, expected, result.Message)
+					}
+				default:
+					t.Errorf("wrong result for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				}
+			}
+		}
+	})
+}
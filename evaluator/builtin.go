@@ -2,16 +2,58 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"monkey/object"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": { Fn: builtinLen },
-	"first": { Fn: builtinFirst },
-	"last": { Fn: builtinLast },
-	"rest": { Fn: builtinRest },
-	"push": { Fn: builtinPush },
-	"puts": { Fn: builtinPuts },
+var builtins = NewBuiltins(os.Stdout)
+
+// NewBuiltins returns a new set of the default builtins whose puts writes
+// to out.
+func NewBuiltins(out io.Writer) map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"len": { Fn: builtinLen },
+		"first": { Fn: builtinFirst },
+		"last": { Fn: builtinLast },
+		"rest": { Fn: builtinRest },
+		"push": { Fn: builtinPush },
+		"puts": { Fn: newBuiltinPuts(out) },
+		"int": { Fn: builtinInt },
+		"float": { Fn: builtinFloat },
+		"bytes": { Fn: builtinBytes },
+		"byte_len": { Fn: builtinByteLen },
+		"keys": { Fn: builtinKeys },
+		"values": { Fn: builtinValues },
+		"entries": { Fn: builtinEntries },
+		"has": { Fn: builtinHas },
+		"delete": { Fn: builtinDelete },
+		"merge": { Fn: builtinMerge },
+		"map": { HigherOrderFn: builtinMap },
+		"filter": { HigherOrderFn: builtinFilter },
+		"reduce": { HigherOrderFn: builtinReduce },
+		"sort": { HigherOrderFn: builtinSort },
+		"find": { HigherOrderFn: builtinFind },
+		"any": { HigherOrderFn: builtinAny },
+		"all": { HigherOrderFn: builtinAll },
+		"split": { Fn: builtinSplit },
+		"join": { Fn: builtinJoin },
+		"trim": { Fn: builtinTrim },
+		"upper": { Fn: builtinUpper },
+		"lower": { Fn: builtinLower },
+		"replace": { Fn: builtinReplace },
+		"contains": { Fn: builtinContains },
+		"starts_with": { Fn: builtinStartsWith },
+		"ends_with": { Fn: builtinEndsWith },
+		"index_of": { Fn: builtinIndexOf },
+		"repeat": { Fn: builtinRepeat },
+		"substr": { Fn: builtinSubstr },
+		"format": { Fn: builtinFormat },
+	}
 }
 
 func builtinLen(args ...object.Object) object.Object {
@@ -21,9 +63,11 @@ func builtinLen(args ...object.Object) object.Object {
 
 	switch arg := args[0].(type) {
 	case *object.String:
-		return &object.Integer{Value: int64(len(arg.Value))}
+		return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 	case *object.Array:
 		return &object.Integer{Value: int64(len(arg.Elements))}
+	case *object.Hash:
+		return &object.Integer{Value: int64(arg.Len())}
 	default:
 		return newError("argument to `len` not supported, got %s", arg.Type())
 	}
@@ -105,11 +149,212 @@ func builtinPush(args ...object.Object) object.Object {
 	}
 }
 
-func builtinPuts(args ...object.Object) object.Object {
-	for _, obj := range args {
-		fmt.Println(obj.Inspect())
+func newBuiltinPuts(out io.Writer) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		for _, obj := range args {
+			fmt.Fprintln(out, obj.Inspect())
+		}
+
+		return NULL
+	}
+}
+
+// builtinInt converts a number or a string to an integer. Floats are
+// truncated toward zero and big integers must fit in an int64.
+func builtinInt(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		return arg
+	case *object.BigInt:
+		if !arg.Value.IsInt64() {
+			return newError("bigint %s out of integer range", arg.Inspect())
+		}
+		return &object.Integer{Value: arg.Value.Int64()}
+	case *object.Float:
+		value := math.Trunc(arg.Value)
+		if math.IsNaN(value) || value < math.MinInt64 || value >= math.MaxInt64 {
+			return newError("float %s out of integer range", arg.Inspect())
+		}
+		return &object.Integer{Value: int64(value)}
+	case *object.String:
+		value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+		if err != nil {
+			return newError("could not parse %q as integer", arg.Value)
+		}
+		return &object.Integer{Value: value}
+	default:
+		return newError("argument to `int` not supported, got %s", arg.Type())
+	}
+}
+
+func builtinFloat(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Integer, *object.BigInt:
+		return &object.Float{Value: toFloat(arg)}
+	case *object.Float:
+		return arg
+	case *object.String:
+		value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+		if err != nil {
+			return newError("could not parse %q as float", arg.Value)
+		}
+		return &object.Float{Value: value}
+	default:
+		return newError("argument to `float` not supported, got %s", arg.Type())
+	}
+}
+
+// builtinBytes returns the UTF-8 encoding of a string as an array of
+// integers.
+func builtinBytes(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `bytes` must be STRING, got %s", args[0].Type())
 	}
 
-	return NULL
+	elements := make([]object.Object, len(str.Value))
+	for i := 0; i < len(str.Value); i++ {
+		elements[i] = &object.Integer{Value: int64(str.Value[i])}
+	}
+	return &object.Array{Elements: elements}
 }
 
+func builtinByteLen(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `byte_len` must be STRING, got %s", args[0].Type())
+	}
+
+	return &object.Integer{Value: int64(len(str.Value))}
+}
+
+func builtinKeys(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("argument to `keys` must be HASH, got %s", args[0].Type())
+	}
+
+	elements := make([]object.Object, 0, hash.Len())
+	for _, pair := range hash.Pairs() {
+		elements = append(elements, pair.Key)
+	}
+	return &object.Array{Elements: elements}
+}
+
+func builtinValues(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("argument to `values` must be HASH, got %s", args[0].Type())
+	}
+
+	elements := make([]object.Object, 0, hash.Len())
+	for _, pair := range hash.Pairs() {
+		elements = append(elements, pair.Value)
+	}
+	return &object.Array{Elements: elements}
+}
+
+// builtinEntries returns the pairs of a hash as [key, value] arrays.
+func builtinEntries(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("argument to `entries` must be HASH, got %s", args[0].Type())
+	}
+
+	elements := make([]object.Object, 0, hash.Len())
+	for _, pair := range hash.Pairs() {
+		entry := &object.Array{Elements: []object.Object{pair.Key, pair.Value}}
+		elements = append(elements, entry)
+	}
+	return &object.Array{Elements: elements}
+}
+
+func builtinHas(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("argument to `has` must be HASH, got %s", args[0].Type())
+	}
+	if _, ok := args[1].(object.Hasher); !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	_, ok = hash.Get(args[1])
+	return nativeBoolToBooleanObject(ok)
+}
+
+// builtinDelete returns a copy of a hash without the given key. The hash
+// itself is not changed.
+func builtinDelete(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("argument to `delete` must be HASH, got %s", args[0].Type())
+	}
+	if _, ok := args[1].(object.Hasher); !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	deleted, _ := hash.Get(args[1])
+	result := &object.Hash{}
+	for _, pair := range hash.Pairs() {
+		if pair.Key != deleted.Key {
+			result.Set(pair.Key, pair.Value)
+		}
+	}
+	return result
+}
+
+// builtinMerge returns a new hash with the pairs of two hashes. Where both
+// have a key, the value of the second one wins.
+func builtinMerge(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	result := &object.Hash{}
+	for _, arg := range args {
+		hash, ok := arg.(*object.Hash)
+		if !ok {
+			return newError("argument to `merge` must be HASH, got %s", arg.Type())
+		}
+		for _, pair := range hash.Pairs() {
+			result.Set(pair.Key, pair.Value)
+		}
+	}
+	return result
+}
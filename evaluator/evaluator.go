@@ -1,106 +1,238 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"math/big"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
+	"strings"
 )
 
 var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+// Config customizes an evaluation. The zero value uses the default
+// builtins, whose puts writes to os.Stdout, and the default limits.
+type Config struct {
+	Builtins map[string]*object.Builtin
+	Limits   Limits
+	Overflow Overflow
+}
+
+// Eval evaluates node in env. It stops with an error of kind
+// object.LimitError when ctx is done or the default limits are exceeded.
+func Eval(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return EvalWithConfig(ctx, node, env, Config{})
+}
+
+func EvalWithConfig(
+	ctx context.Context,
+	node ast.Node,
+	env *object.Environment,
+	config Config,
+) object.Object {
+	e := newEvaluation(ctx, config)
+	return e.Eval(node, env)
+}
+
+// Apply calls the Monkey function or builtin fn with args.
+func Apply(
+	ctx context.Context,
+	fn object.Object,
+	args []object.Object,
+	config Config,
+) object.Object {
+	e := newEvaluation(ctx, config)
+	return e.applyFuntion(fn, args, token.Position{})
+}
+
+// evaluation holds the state of a single call to Eval.
+type evaluation struct {
+	builtins map[string]*object.Builtin
+	meter    *Meter
+	overflow Overflow
+	stack    []frame
+}
+
+func newEvaluation(ctx context.Context, config Config) *evaluation {
+	e := &evaluation{
+		builtins: config.Builtins,
+		meter:    NewMeter(ctx, config.Limits),
+		overflow: config.Overflow,
+	}
+	if e.builtins == nil {
+		e.builtins = builtins
+	}
+	return e
+}
+
+// frame is an active call of a Monkey function.
+type frame struct {
+	function string
+	callPos  token.Position
+}
+
+func (e *evaluation) Eval(node ast.Node, env *object.Environment) object.Object {
+	var result object.Object
+	if err := e.meter.Step(); err != nil {
+		result = err
+	} else {
+		result = e.eval(node, env)
+	}
+
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Span().Start
+		err.Trace = e.trace(err.Pos)
+	}
+	return result
+}
+
+// allocate counts obj against the allocation limit. It returns obj, or an
+// error if the limit is exceeded.
+func (e *evaluation) allocate(obj object.Object) object.Object {
+	if err := e.meter.Allocate(obj); err != nil {
+		return err
+	}
+	return obj
+}
+
+// trace returns the current call stack, innermost call first, with the
+// innermost call being at pos.
+func (e *evaluation) trace(pos token.Position) []object.Frame {
+	trace := make([]object.Frame, 0, len(e.stack)+1)
+	for i := len(e.stack) - 1; i >= 0; i-- {
+		trace = append(trace, object.Frame{Function: e.stack[i].function, Pos: pos})
+		pos = e.stack[i].callPos
+	}
+	return append(trace, object.Frame{Function: object.MainFunction, Pos: pos})
+}
+
+func (e *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return e.allocate(&object.Integer{Value: node.Value})
+	case *ast.BigIntegerLiteral:
+		return e.allocate(&object.BigInt{Value: node.Value})
+	case *ast.FloatLiteral:
+		return e.allocate(&object.Float{Value: node.Value})
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return e.allocate(&object.String{Value: node.Value})
+	case *ast.InterpolatedString:
+		parts := e.evalExpressions(node.Parts, env)
+		if len(parts) == 1 && isError(parts[0]) {
+			return parts[0]
+		}
+		return e.allocate(interpolate(parts))
 	case *ast.Boolean:
 		return evalBoolean(node)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return e.allocate(evalPrefixExpression(node.Operator, right, e.overflow))
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, env)
+		}
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return e.allocate(evalInfixExpression(node.Operator, left, right, e.overflow))
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return e.evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := e.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
 	case *ast.FunctionLiteral:
-		return &object.Function{
+		return e.allocate(&object.Function{
+			Name:       node.Name,
 			Body:       node.Body,
 			Parameters: node.Parameters,
 			Env:        env,
-		}
+		})
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+			return e.quote(node, env)
+		}
+		function := e.Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFuntion(function, args)
+		return e.applyFuntion(function, args, node.Span().Start)
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return e.allocate(&object.Array{Elements: elements})
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := e.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
+	case *ast.MacroLiteral:
+		return newError("macros can only be defined by top level let statements")
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *evaluation) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
@@ -115,12 +247,21 @@ func evalBoolean(boolean *ast.Boolean) *object.Boolean {
 	return nativeBoolToBooleanObject(boolean.Value)
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, overflow Overflow) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return evalMinusPrefixOperatorExpression(right, overflow)
+	case "~":
+		switch right := right.(type) {
+		case *object.Integer:
+			return &object.Integer{Value: ^right.Value}
+		case *object.BigInt:
+			return &object.BigInt{Value: new(big.Int).Not(right.Value)}
+		default:
+			return newError("unknown operator: ~%s", right.Type())
+		}
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
@@ -139,23 +280,32 @@ func evalBangOperatorExpression(right object.Object) *object.Boolean {
 	}
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	integer, ok := right.(*object.Integer)
-	if !ok {
+func evalMinusPrefixOperatorExpression(right object.Object, overflow Overflow) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return evalIntegerNegation(right.Value, overflow)
+	case *object.BigInt:
+		return &object.BigInt{Value: new(big.Int).Neg(right.Value)}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	return &object.Integer{Value: -integer.Value}
 }
 
 func evalInfixExpression(
 	operator string,
 	left object.Object,
 	right object.Object,
+	overflow Overflow,
 ) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, overflow)
+	case isInteger(left) && isInteger(right):
+		return evalBigIntInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
@@ -175,27 +325,100 @@ func evalInfixExpression(
 	}
 }
 
+// evalLogicalExpression evaluates && and ||, which only evaluate their
+// right operand if the left one doesn't decide the result.
+func (e *evaluation) evalLogicalExpression(
+	node *ast.InfixExpression,
+	env *object.Environment,
+) object.Object {
+	left := e.Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if isTruthy(left) == (node.Operator == "||") {
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+
+	right := e.Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 func evalIntegerInfixExpression(
 	operator string,
 	left object.Object,
 	right object.Object,
+	overflow Overflow,
 ) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	switch operator {
+	case "+", "-", "*", "/", "%":
+		return evalIntegerArithmetic(operator, leftVal, rightVal, overflow)
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: leftVal << rightVal}
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError(
+			"unknown operator: %s %s %s",
+			left.Type(), operator, right.Type(),
+		)
+	}
+}
+
+// evalFloatInfixExpression evaluates operations on two numbers of which at
+// least one is a float. The integer is converted to a float.
+func evalFloatInfixExpression(
+	operator string,
+	left object.Object,
+	right object.Object,
+) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return &object.Float{Value: leftVal + rightVal}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return &object.Float{Value: leftVal - rightVal}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return &object.Float{Value: leftVal * rightVal}
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		return &object.Float{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -208,21 +431,66 @@ func evalIntegerInfixExpression(
 	}
 }
 
+func isNumber(obj object.Object) bool {
+	return isInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+func isInteger(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIGINT_OBJ
+}
+
+// toFloat converts a number to a float.
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	default:
+		return obj.(*object.Float).Value
+	}
+}
+
+// interpolate joins the parts of an interpolated string. Values are
+// formatted by their Inspect method.
+func interpolate(parts []object.Object) *object.String {
+	var out strings.Builder
+	for _, part := range parts {
+		out.WriteString(part.Inspect())
+	}
+	return &object.String{Value: out.String()}
+}
+
 func evalStringInfixExpression(
 	operator string,
 	left object.Object,
 	right object.Object,
 ) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
 
-	if operator != "+" {
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
 		return newError(
 			"unknown operator: %s %s %s",
 			left.Type(), operator, right.Type(),
 		)
 	}
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
 }
 
 func nativeBoolToBooleanObject(boolean bool) *object.Boolean {
@@ -233,17 +501,17 @@ func nativeBoolToBooleanObject(boolean bool) *object.Boolean {
 	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (e *evaluation) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
 
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.Eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
@@ -262,26 +530,158 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func evalBlockStatement(
+func (e *evaluation) evalBlockStatement(
 	block *ast.BlockStatement,
 	env *object.Environment,
 ) object.Object {
 	var result object.Object
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		if result == nil {
 			continue
 		}
 
 		rt := result.Type()
-		if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+		if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+			rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 			return result
 		}
 	}
+
+	// Blocks are used as values, such as the result of a function, even if
+	// they end in a statement without a value.
+	if result == nil {
+		return NULL
+	}
 	return result
 }
 
+// evalLoopBody evaluates the body of a loop. It returns whether the loop
+// should go on and, if not, the result that ends the enclosing statements.
+func (e *evaluation) evalLoopBody(
+	body *ast.BlockStatement,
+	env *object.Environment,
+) (bool, object.Object) {
+	switch result := e.Eval(body, env).(type) {
+	case *object.Break:
+		return false, nil
+	case *object.ReturnValue, *object.Error:
+		return false, result
+	default:
+		return true, nil
+	}
+}
+
+func (e *evaluation) evalWhileStatement(
+	ws *ast.WhileStatement,
+	env *object.Environment,
+) object.Object {
+	for {
+		condition := e.Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if next, result := e.evalLoopBody(ws.Body, env); !next {
+			return result
+		}
+	}
+}
+
+func (e *evaluation) evalForStatement(
+	fs *ast.ForStatement,
+	env *object.Environment,
+) object.Object {
+	iterable := e.Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	iterator, err := NewIterator(iterable)
+	if err != nil {
+		return err
+	}
+
+	for {
+		key, value, ok := iterator.Next(fs.Key != nil)
+		if !ok {
+			return nil
+		}
+
+		if fs.Key != nil {
+			env.Set(fs.Key.Value, key)
+		}
+		env.Set(fs.Value.Value, value)
+
+		if next, result := e.evalLoopBody(fs.Body, env); !next {
+			return result
+		}
+	}
+}
+
+// evalAssignExpression assigns to a variable declared in env or one of its
+// outer environments, or to an element of an array or hash. A compound
+// assignment reads the target before it evaluates the value.
+func (e *evaluation) evalAssignExpression(
+	node *ast.AssignExpression,
+	env *object.Environment,
+) object.Object {
+	var current func() object.Object
+	var assign func(object.Object) object.Object
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		current = func() object.Object { return e.evalIdentifier(target, env) }
+		assign = func(value object.Object) object.Object {
+			if !env.Assign(target.Value, value) {
+				return newError("assignment to undeclared identifier: " + target.Value)
+			}
+			return value
+		}
+	case *ast.IndexExpression:
+		left := e.Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := e.Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		current = func() object.Object { return evalIndexExpression(left, index) }
+		assign = func(value object.Object) object.Object {
+			return evalIndexAssignment(left, index, value)
+		}
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+
+	operator := strings.TrimSuffix(node.Operator, "=")
+	var left object.Object
+	if operator != "" {
+		left = current()
+		if isError(left) {
+			return left
+		}
+	}
+
+	value := e.Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	if operator != "" {
+		value = e.allocate(evalInfixExpression(operator, left, value, e.overflow))
+		if isError(value) {
+			return value
+		}
+	}
+	return assign(value)
+}
+
 func newError(format string, args ...interface{}) *object.Error {
 	return &object.Error{
 		Message: fmt.Sprintf(format, args...),
@@ -295,25 +695,25 @@ func isError(obj object.Object) bool {
 	return obj.Type() == object.ERROR_OBJ
 }
 
-func evalIdentifier(
+func (e *evaluation) evalIdentifier(
 	ident *ast.Identifier,
 	env *object.Environment,
 ) object.Object {
 	if val, ok := env.Get(ident.Value); ok {
 		return val
 	}
-	if val, ok := builtins[ident.Value]; ok {
+	if val, ok := e.builtins[ident.Value]; ok {
 		return val
 	}
 	return newError("identifier not found: " + ident.Value)
 }
 
-func evalExpressions(
+func (e *evaluation) evalExpressions(
 	exps []ast.Expression,
 	env *object.Environment,
 ) (result []object.Object) {
 	for _, exp := range exps {
-		val := Eval(exp, env)
+		val := e.Eval(exp, env)
 		if isError(val) {
 			return []object.Object{val}
 		}
@@ -322,17 +722,42 @@ func evalExpressions(
 	return
 }
 
-func applyFuntion(
+func (e *evaluation) applyFuntion(
 	fn object.Object,
 	args []object.Object,
+	callPos token.Position,
 ) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError(
+				"wrong number of arguments. got=%d, want=%d",
+				len(args), len(fn.Parameters),
+			)
+		}
+
+		if len(e.stack)+1 >= e.meter.MaxDepth() {
+			return StackOverflow()
+		}
+
+		name := fn.Name
+		if name == "" {
+			name = object.AnonymousFunction
+		}
+		e.stack = append(e.stack, frame{function: name, callPos: callPos})
+		defer func() { e.stack = e.stack[:len(e.stack)-1] }()
+
 		extendedEnv := extendedFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		evaluated := e.Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if fn.HigherOrderFn != nil {
+			call := func(callee object.Object, args ...object.Object) object.Object {
+				return e.applyFuntion(callee, args, callPos)
+			}
+			return e.allocate(fn.HigherOrderFn(call, args...))
+		}
+		return e.allocate(fn.Fn(args...))
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
@@ -363,6 +788,8 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -370,6 +797,23 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 	}
 }
 
+// evalStringIndexExpression returns the character at index, counting in
+// runes rather than bytes.
+func evalStringIndexExpression(left object.Object, index object.Object) object.Object {
+	str := left.(*object.String).Value
+	idx := index.(*object.Integer).Value
+	if idx < 0 {
+		return NULL
+	}
+	for _, char := range str {
+		if idx == 0 {
+			return &object.String{Value: string(char)}
+		}
+		idx--
+	}
+	return NULL
+}
+
 func evalArrayIndexExpression(left object.Object, index object.Object) object.Object {
 	arr := left.(*object.Array)
 	idx := index.(*object.Integer).Value
@@ -379,33 +823,52 @@ func evalArrayIndexExpression(left object.Object, index object.Object) object.Ob
 	return arr.Elements[idx]
 }
 
-func evalHashLiteral(
+func evalIndexAssignment(left object.Object, index object.Object, value object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		arr := left.(*object.Array)
+		idx := index.(*object.Integer).Value
+		if idx < 0 || int64(len(arr.Elements)) <= idx {
+			return newError("index out of range: %d", idx)
+		}
+		arr.Elements[idx] = value
+		return value
+	case left.Type() == object.HASH_OBJ:
+		if _, ok := index.(object.Hasher); !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.(*object.Hash).Set(index, value)
+		return value
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+func (e *evaluation) evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{}
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	for _, pair := range node.Pairs {
+		key := e.Eval(pair.Key, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hasher)
-		if !ok {
+		if _, ok := key.(object.Hasher); !ok {
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := e.Eval(pair.Value, env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(key, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return e.allocate(hash)
 }
 
 func evalHashIndexExpression(
@@ -414,15 +877,48 @@ func evalHashIndexExpression(
 ) object.Object {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hasher)
-	if !ok {
-		newError("unusable as hash key: %s", index.Inspect())
+	if _, ok := index.(object.Hasher); !ok {
+		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Get(index)
 	if !ok {
 		return NULL
 	}
 
 	return pair.Value
 }
+
+// The functions below expose the semantics of the evaluator to other
+// backends, so that the virtual machine behaves the same way.
+
+func InfixOperation(
+	operator string,
+	left object.Object,
+	right object.Object,
+	overflow Overflow,
+) object.Object {
+	return evalInfixExpression(operator, left, right, overflow)
+}
+
+func PrefixOperation(operator string, right object.Object, overflow Overflow) object.Object {
+	return evalPrefixExpression(operator, right, overflow)
+}
+
+func IndexOperation(left object.Object, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// IndexAssignment sets the element index of left to value. It returns
+// value or an error.
+func IndexAssignment(left object.Object, index object.Object, value object.Object) object.Object {
+	return evalIndexAssignment(left, index, value)
+}
+
+func Interpolate(parts []object.Object) object.Object {
+	return interpolate(parts)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
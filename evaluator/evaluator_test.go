@@ -1,128 +1,233 @@
-package evaluator
+package evaluator_test
 
 import (
+	"context"
+	"fmt"
+	"monkey/compiler"
+	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/vm"
+	"strings"
 	"testing"
 )
 
-func TestEvalIntegerExpression(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"5", 5},
-		{"10", 10},
-		{"-5", -5},
-		{"-10", -10},
-		{"5 + 5 + 5 + 5 - 10", 10},
-		{"2 * 2 * 2 * 2 * 2", 32},
-		{"-50 + 100 + -50", 0},
-		{"5 * 2 + 10", 20},
-		{"5 + 2 * 10", 25},
-		{"20 + 2 * -10", 0},
-		{"50 / 2 * 2 + 10", 60},
-		{"2 * (5 + 10)", 30},
-		{"3 * 3 * 3 + 10", 37},
-		{"3 * (3 * 3) + 10", 37},
-		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
-	}
+// The tests in this package run against every backend, so that the
+// evaluator and the virtual machine are held to the same semantics.
+var backends = []string{"evaluator", "vm"}
+
+// backend is the backend used by testEval in the running subtest.
+var backend string
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testIntegerObject(t, evaluated, tt.expected)
+// forEachBackend runs test as a subtest named after each backend.
+func forEachBackend(t *testing.T, test func(t *testing.T)) {
+	for _, b := range backends {
+		t.Run(b, func(t *testing.T) {
+			backend = b
+			test(t)
+		})
 	}
 }
 
+func TestEvalIntegerExpression(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected int64
+		}{
+			{"5", 5},
+			{"10", 10},
+			{"-5", -5},
+			{"-10", -10},
+			{"5 + 5 + 5 + 5 - 10", 10},
+			{"2 * 2 * 2 * 2 * 2", 32},
+			{"-50 + 100 + -50", 0},
+			{"5 * 2 + 10", 20},
+			{"5 + 2 * 10", 25},
+			{"20 + 2 * -10", 0},
+			{"50 / 2 * 2 + 10", 60},
+			{"2 * (5 + 10)", 30},
+			{"3 * 3 * 3 + 10", 37},
+			{"3 * (3 * 3) + 10", 37},
+			{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+			{"0x10 + 0o10 + 0b10 + 1_000", 1026},
+			{"7 % 3", 1},
+			{"-7 % 3", -1},
+			{"0b1100 & 0b1010", 8},
+			{"0b1100 | 0b1010", 14},
+			{"0b1100 ^ 0b1010", 6},
+			{"~0", -1},
+			{"~5 & 0xF", 10},
+			{"1 << 10", 1024},
+			{"-16 >> 2", -4},
+			{"1 << 64", 0},
+			{"0o755 & ~0o022", 0o755},
+			{"1 + 2 << 3 | 1", 25},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testIntegerObject(t, evaluated, tt.expected)
+		}
+	})
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{"1.5", 1.5},
+			{".5", 0.5},
+			{"1e3", 1000},
+			{"2.5E-1", 0.25},
+			{"-1.5", -1.5},
+			{"1.5 + 1.5", 3},
+			{"1 + 0.5", 1.5},
+			{"0.5 + 1", 1.5},
+			{"5 - 1.5", 3.5},
+			{"2 * 1.25", 2.5},
+			{"7 / 2.0", 3.5},
+			{"1.0 / 4", 0.25},
+			{"(1 + 2 + 3 + 4) / 4.0", 2.5},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testFloatObject(t, evaluated, tt.expected)
+		}
+	})
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-	}{
-		{"true", true},
-		{"false", false},
-		{"1 < 2", true},
-		{"1 > 2", false},
-		{"1 < 1", false},
-		{"1 > 1", false},
-		{"1 == 1", true},
-		{"1 != 1", false},
-		{"1 == 2", false},
-		{"1 != 2", true},
-		{"true == true", true},
-		{"false == false", true},
-		{"true == false", false},
-		{"true != false", true},
-		{"false != true", true},
-		{"(1 < 2) == true", true},
-		{"(1 < 2) == false", false},
-		{"(1 > 2) == true", false},
-		{"(1 > 2) == false", true},
-	}
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected bool
+		}{
+			{"true", true},
+			{"false", false},
+			{"1 < 2", true},
+			{"1 > 2", false},
+			{"1 < 1", false},
+			{"1 > 1", false},
+			{"1 == 1", true},
+			{"1 != 1", false},
+			{"1 == 2", false},
+			{"1 != 2", true},
+			{"true == true", true},
+			{"false == false", true},
+			{"true == false", false},
+			{"true != false", true},
+			{"false != true", true},
+			{"(1 < 2) == true", true},
+			{"(1 < 2) == false", false},
+			{"(1 > 2) == true", false},
+			{"(1 > 2) == false", true},
+			{"1.5 < 2", true},
+			{"2 < 1.5", false},
+			{"1.5 > 1", true},
+			{"1.0 == 1", true},
+			{"1 != 1.0", false},
+			{"0.1 + 0.2 == 0.3", false},
+			{"1 <= 1", true},
+			{"2 <= 1", false},
+			{"1 >= 1", true},
+			{"1 >= 2", false},
+			{"1.5 <= 2", true},
+			{"2 >= 2.5", false},
+			{"true && true", true},
+			{"true && false", false},
+			{"false && true", false},
+			{"false || true", true},
+			{"false || false", false},
+			{"1 && \"a\"", true},
+			{"1 < 2 && 2 < 3", true},
+			{"1 > 2 || 2 > 3", false},
+			{"if (false) { 1 } || 0", true},
+			{"if (false) { 1 } && true", false},
+			{`"a" == "a"`, true},
+			{`"a" == "b"`, false},
+			{`"a" != "b"`, true},
+			{`"a" + "b" == "ab"`, true},
+			{`"apple" < "banana"`, true},
+			{`"b" > "abc"`, true},
+			{`"ab" < "a"`, false},
+			{`"a" <= "a"`, true},
+			{`"a" >= "b"`, false},
+			{`"a" == 1`, false},
+		}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testBooleanObject(t, evaluated, tt.expected)
-	}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testBooleanObject(t, evaluated, tt.expected)
+		}
+	})
 }
 
 func TestBangOperator(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-	}{
-		{"!true", false},
-		{"!false", true},
-		{"!5", false},
-		{"!!true", true},
-		{"!!false", false},
-		{"!!5", true},
-	}
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected bool
+		}{
+			{"!true", false},
+			{"!false", true},
+			{"!5", false},
+			{"!!true", true},
+			{"!!false", false},
+			{"!!5", true},
+		}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testBooleanObject(t, evaluated, tt.expected)
-	}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testBooleanObject(t, evaluated, tt.expected)
+		}
+	})
 }
 
 func TestIfElseExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{"if (true) { 10 }", 10},
-		{"if (false) { 10 }", nil},
-		{"if (1) { 10 }", 10},
-		{"if (1 < 2) { 10 }", 10},
-		{"if (1 > 2) { 10 }", nil},
-		{"if (1 > 2) { 10 } else { 20 }", 20},
-		{"if (1 < 2) { 10 } else { 20 }", 10},
-	}
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"if (true) { 10 }", 10},
+			{"if (false) { 10 }", nil},
+			{"if (1) { 10 }", 10},
+			{"if (1 < 2) { 10 }", 10},
+			{"if (1 > 2) { 10 }", nil},
+			{"if (1 > 2) { 10 } else { 20 }", 20},
+			{"if (1 < 2) { 10 } else { 20 }", 10},
+		}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		integer, ok := tt.expected.(int)
-		if ok {
-			testIntegerObject(t, evaluated, int64(integer))
-		} else {
-			testNullObject(t, evaluated)
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			integer, ok := tt.expected.(int)
+			if ok {
+				testIntegerObject(t, evaluated, int64(integer))
+			} else {
+				testNullObject(t, evaluated)
+			}
 		}
-	}
+	})
 }
 
 func TestReturnStatements(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"return 10;", 10},
-		{"return 10; 9;", 10},
-		{"return 2 * 5; 9;", 10},
-		{"9; return 2 * 5; 9;", 10},
-		{"if (10 > 1) { return 10; }", 10},
-		{
-			`
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected int64
+		}{
+			{"return 10;", 10},
+			{"return 10; 9;", 10},
+			{"return 2 * 5; 9;", 10},
+			{"9; return 2 * 5; 9;", 10},
+			{"if (10 > 1) { return 10; }", 10},
+			{
+				`
 if (10 > 1) {
   if (10 > 1) {
     return 10;
@@ -131,74 +236,341 @@ if (10 > 1) {
   return 1;
 }
 `,
-			10,
-		},
-		{
-			`
+				10,
+			},
+			{
+				`
 let f = fn(x) {
   return x;
   x + 10;
 };
 f(10);`,
-			10,
-		},
-		{
-			`
+				10,
+			},
+			{
+				`
 let f = fn(x) {
    let result = x + 10;
    return result;
    return 10;
 };
 f(10);`,
-			20,
-		},
-	}
+				20,
+			},
+		}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testIntegerObject(t, evaluated, tt.expected)
-	}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testIntegerObject(t, evaluated, tt.expected)
+		}
+	})
+}
+
+func TestWhileLoops(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"let i = 0; let sum = 0; while (i < 5) { let sum = sum + i; let i = i + 1; }; sum", 10},
+			{"let i = 0; while (true) { if (i > 3) { break }; let i = i + 1; }; i", 4},
+			{"let i = 0; while (false) { let i = 1; }; i", 0},
+			{
+				"let i = 0; let odd = 0; while (i < 10) { let i = i + 1; if (i / 2 * 2 == i) { continue }; let odd = odd + 1; }; odd",
+				5,
+			},
+			{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 7) { return i; } } }; f()", 7},
+			{"let f = fn() { while (false) { 1 } }; f()", nil},
+			{"let f = fn() { let x = 1; }; f()", nil},
+			{
+				"let n = 0; let i = 0; while (i < 3) { let j = 0; while (true) { if (j == 2) { break }; let j = j + 1; let n = n + 1; }; let i = i + 1; }; n",
+				6,
+			},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			if expected, ok := tt.expected.(int); ok {
+				testIntegerObject(t, evaluated, int64(expected))
+			} else {
+				testNullObject(t, evaluated)
+			}
+		}
+	})
+}
+
+func TestLoopControlInExpressions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{
+				"let i = 0; while (i < 5) { i += 1; let y = if (i == 2) { break } else { 0 }; }; i",
+				"1:58: break inside an expression whose value is used",
+			},
+			{
+				"let c = true; while (true) { puts(if (c) { break } else { 0 }) }",
+				"1:44: break inside an expression whose value is used",
+			},
+			{
+				"while (true) { 1 + if (true) { continue } else { 2 } }",
+				"1:32: continue inside an expression whose value is used",
+			},
+			{
+				"while (true) { let y = if (true) { if (true) { break } }; }",
+				"1:48: break inside an expression whose value is used",
+			},
+			{"let i = 0; while (true) { i += 1; if (i == 2) { if (true) { break } } }; i", 2},
+			{"let i = 0; while (i < 3) { let f = if (true) { fn() { while (true) { break } } }; f(); i += 1 }; i", 3},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case string:
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Errorf("no error object returned for %q. got=%T(%+v)",
+						tt.input, evaluated, evaluated)
+					continue
+				}
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+			}
+		}
+	})
+}
+
+func TestForLoops(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; }; sum", 6},
+			{"let sum = 0; for (i, x in [10, 20, 30]) { let sum = sum + i * x; }; sum", 80},
+			{"let n = 0; for (x in []) { let n = n + 1; }; n", 0},
+			{`let s = ""; for (c in "abc") { let s = c + s; }; s`, "cba"},
+			{`let n = 0; for (i, c in "abc") { let n = n + i; }; n`, 3},
+			{`let s = ""; for (c in "héllo") { let s = c + s; }; s`, "olléh"},
+			{`let n = 0; for (i, c in "日本語") { let n = i; }; n`, 2},
+			{`let sum = 0; for (k, v in {"a": 1, "b": 2}) { let sum = sum + v; }; sum`, 3},
+			{`let sum = 0; for (pair in {1: 10, 2: 20}) { let sum = sum + pair[0] * pair[1]; }; sum`, 50},
+			{"let last = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break }; let last = x; }; last", 2},
+			{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { continue }; let sum = sum + x; }; sum", 7},
+			{"let find = fn(xs, y) { for (i, x in xs) { if (x == y) { return i; } }; -1 }; find([5, 6, 7], 7)", 2},
+			{"let find = fn(xs, y) { for (i, x in xs) { if (x == y) { return i; } }; -1 }; find([5, 6, 7], 8)", -1},
+			{
+				"let n = 0; for (x in [1, 2, 3]) { for (y in [1, 2, 3]) { if (y > x) { break }; let n = n + 1; } }; n",
+				6,
+			},
+			{"let f = fn(xs) { for (x in xs) { x } }; f([1])", nil},
+			{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case nil:
+				testNullObject(t, evaluated)
+			case string:
+				if errObj, ok := evaluated.(*object.Error); ok {
+					if errObj.Message != expected {
+						t.Errorf("wrong error message. expected=%q, got=%q",
+							expected, errObj.Message)
+					}
+					continue
+				}
+
+				str, ok := evaluated.(*object.String)
+				if !ok {
+					t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+					continue
+				}
+				if str.Value != expected {
+					t.Errorf("String has wrong value. got=%q, want=%q", str.Value, expected)
+				}
+			}
+		}
+	})
+}
+
+func TestAssignments(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"let x = 1; x = 2; x", 2},
+			{"let x = 1; x = x + 1", 2},
+			{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+			{"let a = 0; let b = 0; a = b = 3; a + b", 6},
+			{"let i = 0; let sum = 0; while (i < 5) { sum += i; i += 1; }; sum", 10},
+			{"let x = 1; let f = fn() { x = 5; }; f(); x", 5},
+			{"let x = 1; let f = fn() { let x = 2; x = 3; }; f(); x", 1},
+			{
+				"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()",
+				3,
+			},
+			{
+				"let counter = fn() { let n = 0; fn() { n += 1 } }; let a = counter(); a(); let b = counter(); b(); a()",
+				2,
+			},
+			{
+				"let counter = fn() { let n = 0; let inc = fn() { n += 1 }; inc(); inc(); n }; counter()",
+				2,
+			},
+			{
+				"let f = fn() { let n = 0; let g = fn() { fn() { n += 10 } }; g()(); n }; f()",
+				10,
+			},
+			{
+				"let f = fn(n) { let get = fn() { n }; n = 7; get() }; f(1)",
+				7,
+			},
+			{"let f = fn() { f = 1 }; f(); f", 1},
+			{"let f = fn() { f = 1; f + 1 }; f()", 2},
+			{"let f = fn(n) { if (n > 0) { f(n - 1) } else { f = 5 } }; f(3); f", 5},
+			{"let f = fn() { let i = 0; while (i < 2) { i += 1; f; f = 7 }; f }; f()", 7},
+			{"let g = fn() { let f = fn() { f = 3 }; f(); f }; g()", 3},
+			{"let g = fn() { let f = fn() { fn() { f = 4 } }; f()(); f }; g()", 4},
+			{"let f = 1; let g = fn() { let f = fn() { f = 2 }; f(); f }; g() + f", 3},
+			{"let a = [1, 2, 3]; a[1] = 5; a[0] + a[1] + a[2]", 9},
+			{"let a = [1, 2, 3]; a[2] += 10; a[2]", 13},
+			{`let h = {"a": 1}; h["b"] = 2; h["a"] += 5; h["a"] + h["b"]`, 8},
+			{"let a = [[0]]; a[0][0] = 4; a[0][0]", 4},
+			{"let a = [1]; let b = a; b[0] = 2; a[0]", 2},
+			{"let h = {}; let i = 0; while (i < 3) { h[i] = i * i; i += 1 }; h[2]", 4},
+			{"x = 1", "assignment to undeclared identifier: x"},
+			{"let f = fn() { y = 1 }; f()", "assignment to undeclared identifier: y"},
+			{"len = 1", "assignment to undeclared identifier: len"},
+			{"let a = [1]; a[1] = 2", "index out of range: 1"},
+			{"let a = [1]; a[-1] = 2", "index out of range: -1"},
+			{"let x = 1; x[0] = 2", "index assignment not supported: INTEGER"},
+			{"let h = {}; h[fn(x) { x }] = 1", "unusable as hash key: FUNCTION"},
+			{`let x = 1; x += "a"`, "type mismatch: INTEGER + STRING"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case string:
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Errorf("no error object returned for %q. got=%T(%+v)",
+						tt.input, evaluated, evaluated)
+					continue
+				}
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+			}
+		}
+	})
+}
+
+func TestShortCircuitEvaluation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected int64
+		}{
+			{"let x = 0; false && (x = 1); x", 0},
+			{"let x = 0; true && (x = 1); x", 1},
+			{"let x = 0; true || (x = 1); x", 0},
+			{"let x = 0; false || (x = 1); x", 1},
+			{"let calls = 0; let f = fn() { calls += 1; true }; f() || f() || f(); calls", 1},
+			{"let calls = 0; let f = fn() { calls += 1; false }; f() && f(); calls", 1},
+			{"let f = fn() { false && 1 + true }; if (f()) { 1 } else { 2 }", 2},
+		}
+
+		for _, tt := range tests {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		}
+	})
 }
 
 func TestErrorHandling(t *testing.T) {
-	tests := []struct {
-		input           string
-		expectedMessage string
-	}{
-		{
-			"5 + true;",
-			"type mismatch: INTEGER + BOOLEAN",
-		},
-		{
-			"5 + true; 5;",
-			"type mismatch: INTEGER + BOOLEAN",
-		},
-		{
-			"-true",
-			"unknown operator: -BOOLEAN",
-		},
-		{
-			"true + false;",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"true + false + true + false;",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"5; true + false; 5",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			`"Hello" - "World"`,
-			"unknown operator: STRING - STRING",
-		},
-		{
-			"if (10 > 1) { true + false; }",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			`
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input           string
+			expectedMessage string
+		}{
+			{
+				"5 + true;",
+				"type mismatch: INTEGER + BOOLEAN",
+			},
+			{
+				"5 + true; 5;",
+				"type mismatch: INTEGER + BOOLEAN",
+			},
+			{
+				"-true",
+				"unknown operator: -BOOLEAN",
+			},
+			{
+				"~1.5",
+				"unknown operator: ~FLOAT",
+			},
+			{
+				"1.5 % 2.0",
+				"unknown operator: FLOAT % FLOAT",
+			},
+			{
+				"1 << -1",
+				"negative shift count: -1",
+			},
+			{
+				"8 >> -2",
+				"negative shift count: -2",
+			},
+			{
+				"1.5 + true",
+				"type mismatch: FLOAT + BOOLEAN",
+			},
+			{
+				`1.5 + "a"`,
+				"type mismatch: FLOAT + STRING",
+			},
+			{
+				"{1.5: 1}",
+				"unusable as hash key: FLOAT",
+			},
+			{
+				"true + false;",
+				"unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				"true + false + true + false;",
+				"unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				"5; true + false; 5",
+				"unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				`"Hello" - "World"`,
+				"unknown operator: STRING - STRING",
+			},
+			{
+				"if (10 > 1) { true + false; }",
+				"unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				`
 if (10 > 1) {
   if (10 > 1) {
     return true + false;
@@ -207,100 +579,255 @@ if (10 > 1) {
   return 1;
 }
 `,
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"foobar",
-			"identifier not found: foobar",
-		},
-		// {
-		// 	`{"name": "Monkey"}[fn(x) { x }];`,
-		// 	"unusable as hash key: FUNCTION",
-		// },
-		{
-			`999[1]`,
-			"index operator not supported: INTEGER",
-		},
-	}
+				"unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				"foobar",
+				"identifier not found: foobar",
+			},
+			{
+				"let f = fn(x) { x }; f(1, 2);",
+				"wrong number of arguments. got=2, want=1",
+			},
+			{
+				"let f = fn(x, y) { x }; f(1);",
+				"wrong number of arguments. got=1, want=2",
+			},
+			{
+				"5(1)",
+				"not a function: INTEGER",
+			},
+			{
+				`{"name": "Monkey"}[fn(x) { x }];`,
+				"unusable as hash key: FUNCTION",
+			},
+			{
+				`999[1]`,
+				"index operator not supported: INTEGER",
+			},
+		}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
 
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)",
+					evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != tt.expectedMessage {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					tt.expectedMessage, errObj.Message)
+			}
+		}
+	})
+}
+
+func TestErrorPositions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input            string
+			expectedPosition string
+		}{
+			{"5 + true;", "1:1"},
+			{"let x = 1;\nlet y = x + foobar;", "2:13"},
+			{"let f = fn(a) {\n  -a\n};\nf(true);", "2:3"},
+			{"len(1)", "1:1"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)",
+					evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Pos.String() != tt.expectedPosition {
+				t.Errorf("wrong error position. expected=%s, got=%s",
+					tt.expectedPosition, errObj.Pos)
+			}
+		}
+	})
+}
+
+func TestErrorStackTraces(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		input := `let inner = fn(a) {
+  -a
+};
+let outer = fn(x) {
+  let y = 1;
+  inner(x)
+};
+fn() { outer(true) }();`
+
+		evaluated := testEval(input)
 		errObj, ok := evaluated.(*object.Error)
 		if !ok {
-			t.Errorf("no error object returned. got=%T(%+v)",
-				evaluated, evaluated)
-			continue
+			t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
 		}
 
-		if errObj.Message != tt.expectedMessage {
-			t.Errorf("wrong error message. expected=%q, got=%q",
-				tt.expectedMessage, errObj.Message)
+		expected := []struct {
+			function string
+			position string
+		}{
+			{"inner", "2:3"},
+			{"outer", "6:3"},
+			{object.AnonymousFunction, "8:8"},
+			{object.MainFunction, "8:1"},
 		}
-	}
+
+		if len(errObj.Trace) != len(expected) {
+			t.Fatalf("wrong trace length. want=%d, got=%d\n%s",
+				len(expected), len(errObj.Trace), errObj.StackTrace())
+		}
+
+		for i, tt := range expected {
+			frame := errObj.Trace[i]
+			if frame.Function != tt.function || frame.Pos.String() != tt.position {
+				t.Errorf("trace[%d] wrong. want=%s at %s, got=%s at %s",
+					i, tt.function, tt.position, frame.Function, frame.Pos)
+			}
+		}
+	})
+}
+
+func TestDeepStackTraces(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		evaluated := testEval("let f = fn() { f() }; f()")
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Message != "stack overflow" {
+			t.Fatalf("expected stack overflow. got=%T(%+v)", evaluated, evaluated)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(errObj.StackTrace(), "\n"), "\n")
+		if len(lines) != 41 {
+			t.Fatalf("wrong number of trace lines. want=41, got=%d", len(lines))
+		}
+		elided := fmt.Sprintf("... %d frames elided ...", len(errObj.Trace)-20)
+		if lines[20] != elided {
+			t.Errorf("wrong elision line. want=%q, got=%q", elided, lines[20])
+		}
+		if lines[0] != "f(...)" || lines[39] != object.MainFunction+"(...)" {
+			t.Errorf("trace does not keep its ends. got=%q and %q", lines[0], lines[39])
+		}
+	})
+}
+
+func TestStackOverflowThroughBuiltins(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		evaluated := testEval("let f = fn(x){ map([x], f) }; f(1)")
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Message != "stack overflow" {
+			t.Fatalf("expected stack overflow. got=%T(%+v)", evaluated, evaluated)
+		}
+
+		if errObj.Pos.String() != "1:16" {
+			t.Errorf("wrong error position. want=1:16, got=%s", errObj.Pos)
+		}
+		last := len(errObj.Trace) - 1
+		if first := errObj.Trace[0]; first.Function != "f" || first.Pos.String() != "1:16" {
+			t.Errorf("trace[0] wrong. want=f at 1:16, got=%s at %s", first.Function, first.Pos)
+		}
+		if main := errObj.Trace[last]; main.Pos.String() != "1:31" {
+			t.Errorf("trace[%d] wrong. want=1:31, got=%s", last, main.Pos)
+		}
+	})
 }
 
 func TestLetStatements(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"let a = 5; a;", 5},
-		{"let a = 5 * 5; a;", 25},
-		{"let a = 5; let b = a; b;", 5},
-		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
-	}
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected int64
+		}{
+			{"let a = 5; a;", 5},
+			{"let a = 5 * 5; a;", 25},
+			{"let a = 5; let b = a; b;", 5},
+			{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+			{"let π = 3; let größe = π * 2; größe;", 6},
+		}
 
-	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
-	}
+		for _, tt := range tests {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		}
+	})
 }
 
 func TestFunctionObject(t *testing.T) {
-	input := "fn(x) { x + 2; };"
+	forEachBackend(t, func(t *testing.T) {
+		if backend == "vm" {
+			t.Skip("the vm compiles functions")
+		}
 
-	evaluated := testEval(input)
-	fn, ok := evaluated.(*object.Function)
-	if !ok {
-		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
-	}
+		input := "fn(x) { x + 2; };"
 
-	if len(fn.Parameters) != 1 {
-		t.Fatalf("function has wrong parameters. Parameters=%+v",
-			fn.Parameters)
-	}
+		evaluated := testEval(input)
+		fn, ok := evaluated.(*object.Function)
+		if !ok {
+			t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+		}
 
-	if fn.Parameters[0].String() != "x" {
-		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
-	}
+		if len(fn.Parameters) != 1 {
+			t.Fatalf("function has wrong parameters. Parameters=%+v",
+				fn.Parameters)
+		}
+
+		if fn.Parameters[0].String() != "x" {
+			t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+		}
 
-	expectedBody := "(x + 2)"
+		expectedBody := "(x + 2)"
 
-	if fn.Body.String() != expectedBody {
-		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
-	}
+		if fn.Body.String() != expectedBody {
+			t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+		}
+	})
 }
 
 func TestFunctionApplication(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"let identity = fn(x) { x; }; identity(5);", 5},
-		{"let identity = fn(x) { return x; }; identity(5);", 5},
-		{"let double = fn(x) { x * 2; }; double(5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		{"fn(x) { x; }(5)", 5},
-	}
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected int64
+		}{
+			{"let identity = fn(x) { x; }; identity(5);", 5},
+			{"let identity = fn(x) { return x; }; identity(5);", 5},
+			{"let double = fn(x) { x * 2; }; double(5);", 10},
+			{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+			{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+			{"fn(x) { x; }(5)", 5},
+			{"let f = fn() { g() }; let g = fn() { 5 }; f();", 5},
+			{"let len = fn(x) { 5 }; len([]);", 5},
+			{
+				`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+			fib(10);`,
+				55,
+			},
+			{
+				`let wrapper = fn() {
+				let countDown = fn(x) { if (x == 0) { 0 } else { countDown(x - 1) } };
+				countDown(5) + 5;
+			};
+			wrapper();`,
+				5,
+			},
+		}
 
-	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
-	}
+		for _, tt := range tests {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		}
+	})
 }
 
 func TestEnclosingEnvironments(t *testing.T) {
-	input := `
+	forEachBackend(t, func(t *testing.T) {
+		input := `
 let first = 10;
 let second = 10;
 let third = 10;
@@ -313,11 +840,13 @@ let ourFunction = fn(first) {
 
 ourFunction(20) + first + second;`
 
-	testIntegerObject(t, testEval(input), 70)
+		testIntegerObject(t, testEval(input), 70)
+	})
 }
 
 func TestClosures(t *testing.T) {
-	input := `
+	forEachBackend(t, func(t *testing.T) {
+		input := `
 let newAdder = fn(x) {
   fn(y) { x + y };
 };
@@ -325,180 +854,515 @@ let newAdder = fn(x) {
 let addTwo = newAdder(2);
 addTwo(2);`
 
-	testIntegerObject(t, testEval(input), 4)
+		testIntegerObject(t, testEval(input), 4)
+	})
 }
 
 func TestStringLiteral(t *testing.T) {
-	input := `"Hello World!"`
+	forEachBackend(t, func(t *testing.T) {
+		input := `"Hello World!"`
 
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
-	}
+		evaluated := testEval(input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
 
-	if str.Value != "Hello World!" {
-		t.Errorf("String has wrong value. got=%q", str.Value)
-	}
+		if str.Value != "Hello World!" {
+			t.Errorf("String has wrong value. got=%q", str.Value)
+		}
+	})
+}
+
+func TestStringEscapes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		input := "\"Name:\\t\\\"Monkey\\\"\\n\" + `raw\\n\nend`"
+
+		evaluated := testEval(input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		expected := "Name:\t\"Monkey\"\nraw\\n\nend"
+		if str.Value != expected {
+			t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+		}
+	})
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`let name = "Ann"; let items = [1, 2]; "Hello ${name}, you have ${len(items)} items"`, "Hello Ann, you have 2 items"},
+			{`"${1 + 1} ${1.5} ${true} ${[1, "a"]} ${if (false) { 1 }}"`, "2 1.5 true [1, a] null"},
+			{`let f = fn(x) { "<${x}>" }; "${f(f("a"))}"`, "<<a>>"},
+			{`let h = {"k": 1}; "${h["k"]}"`, "1"},
+			{`"\${x}"`, "${x}"},
+			{`let x = 1; "${x}" + "${x += 1}${x}"`, "122"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if str.Value != tt.expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", tt.expected, str.Value)
+			}
+		}
+
+		evaluated := testEval(`"a ${1 + true} b"`)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Message != "type mismatch: INTEGER + BOOLEAN" {
+			t.Errorf("wrong result for failing interpolation. got=%+v", evaluated)
+		}
+	})
 }
 
 func TestStringConcatenation(t *testing.T) {
-	input := `"Hello" + " " + "World!"`
+	forEachBackend(t, func(t *testing.T) {
+		input := `"Hello" + " " + "World!"`
 
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
-	}
+		evaluated := testEval(input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
 
-	if str.Value != "Hello World!" {
-		t.Errorf("String has wrong value. got=%q", str.Value)
-	}
+		if str.Value != "Hello World!" {
+			t.Errorf("String has wrong value. got=%q", str.Value)
+		}
+	})
 }
 
 func TestBuiltinFunctions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{`len("")`, 0},
-		{`len("four")`, 4},
-		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
-		{`len([1, 2, 3])`, 3},
-		{`len([])`, 0},
-		{`puts("hello", "world!")`, nil},
-		{`first([1, 2, 3])`, 1},
-		{`first([])`, nil},
-		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
-		{`last([1, 2, 3])`, 3},
-		{`last([])`, nil},
-		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
-		{`rest([1, 2, 3])`, []int{2, 3}},
-		{`rest([])`, nil},
-		{`push([], 1)`, []int{1}},
-		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
-	}
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{`len("")`, 0},
+			{`len("four")`, 4},
+			{`len("hello world")`, 11},
+			{`len(1)`, "argument to `len` not supported, got INTEGER"},
+			{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+			{`len([1, 2, 3])`, 3},
+			{`len([])`, 0},
+			{`len("héllo")`, 5},
+			{`len("日本語")`, 3},
+			{`byte_len("héllo")`, 6},
+			{`byte_len(1)`, "argument to `byte_len` must be STRING, got INTEGER"},
+			{`bytes("hé")`, []int{104, 195, 169}},
+			{`bytes("")`, []int{}},
+			{`bytes([])`, "argument to `bytes` must be STRING, got ARRAY"},
+			{`puts("hello", "world!")`, nil},
+			{`first([1, 2, 3])`, 1},
+			{`first([])`, nil},
+			{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+			{`last([1, 2, 3])`, 3},
+			{`last([])`, nil},
+			{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+			{`rest([1, 2, 3])`, []int{2, 3}},
+			{`rest([])`, nil},
+			{`push([], 1)`, []int{1}},
+			{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+			{`int(3)`, 3},
+			{`int(3.9)`, 3},
+			{`int(-3.9)`, -3},
+			{`int("42")`, 42},
+			{`int("4.2")`, `could not parse "4.2" as integer`},
+			{`int(1e300)`, "float 1e+300 out of integer range"},
+			{`int(true)`, "argument to `int` not supported, got BOOLEAN"},
+			{`float(3)`, 3.0},
+			{`float(0.5)`, 0.5},
+			{`float("2.5")`, 2.5},
+			{`float("abc")`, `could not parse "abc" as float`},
+			{`float([])`, "argument to `float` not supported, got ARRAY"},
+			{`float(1, 2)`, "wrong number of arguments. got=2, want=1"},
+		}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case float64:
+				testFloatObject(t, evaluated, expected)
+			case nil:
+				testNullObject(t, evaluated)
+			case string:
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Errorf("object is not Error. got=%T (%+v)",
+						evaluated, evaluated)
+					continue
+				}
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+			case []int:
+				array, ok := evaluated.(*object.Array)
+				if !ok {
+					t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+					continue
+				}
+
+				if len(array.Elements) != len(expected) {
+					t.Errorf("wrong num of elements. want=%d, got=%d",
+						len(expected), len(array.Elements))
+					continue
+				}
+
+				for i, expectedElem := range expected {
+					testIntegerObject(t, array.Elements[i], int64(expectedElem))
+				}
+			}
+		}
+	})
+}
 
-		switch expected := tt.expected.(type) {
-		case int:
-			testIntegerObject(t, evaluated, int64(expected))
-		case nil:
-			testNullObject(t, evaluated)
-		case string:
-			errObj, ok := evaluated.(*object.Error)
-			if !ok {
-				t.Errorf("object is not Error. got=%T (%+v)",
-					evaluated, evaluated)
+func TestHashBuiltins(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`len({})`, "0"},
+			{`len({"a": 1, "b": 2})`, "2"},
+			{`keys({"b": 1, "a": 2, 3: 3})`, "[b, a, 3]"},
+			{`keys({})`, "[]"},
+			{`keys([])`, "argument to `keys` must be HASH, got ARRAY"},
+			{`values({"b": 1, "a": 2})`, "[1, 2]"},
+			{`values(1)`, "argument to `values` must be HASH, got INTEGER"},
+			{`entries({"b": 1, "a": 2})`, "[[b, 1], [a, 2]]"},
+			{`entries({"a": 1}, 2)`, "wrong number of arguments. got=2, want=1"},
+			{`has({"a": 1}, "a")`, "true"},
+			{`has({"a": 1}, "b")`, "false"},
+			{`has({5: 1}, 5n)`, "true"},
+			{`has({"a": 1}, [])`, "unusable as hash key: ARRAY"},
+			{`has([], 1)`, "argument to `has` must be HASH, got ARRAY"},
+			{`delete({"a": 1, "b": 2, "c": 3}, "b")`, "{a: 1, c: 3}"},
+			{`delete({"a": 1}, "z")`, "{a: 1}"},
+			{`let h = {"a": 1, "b": 2}; let d = delete(h, "a"); [h, d]`, "[{a: 1, b: 2}, {b: 2}]"},
+			{`let d = delete({"a": 1}, "a"); d["a"] = 2; d`, "{a: 2}"},
+			{`delete({"a": 1}, fn() {})`, "unusable as hash key: FUNCTION"},
+			{`delete({"a": 1})`, "wrong number of arguments. got=1, want=2"},
+			{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})`, "{a: 1, b: 3, c: 4}"},
+			{`let h = {"a": 1}; merge(h, {"a": 2}); h`, "{a: 1}"},
+			{`merge({}, [])`, "argument to `merge` must be HASH, got ARRAY"},
+			{`merge({})`, "wrong number of arguments. got=1, want=2"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != tt.expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						tt.expected, errObj.Message)
+				}
 				continue
 			}
-			if errObj.Message != expected {
-				t.Errorf("wrong error message. expected=%q, got=%q",
-					expected, errObj.Message)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s",
+					tt.input, tt.expected, evaluated.Inspect())
 			}
-		case []int:
-			array, ok := evaluated.(*object.Array)
-			if !ok {
-				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+		}
+	})
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+			{`map([], fn(x) { x })`, "[]"},
+			{`map(["a", "bc"], len)`, "[1, 2]"},
+			{`let n = 10; map([1, 2], fn(x) { x + n })`, "[11, 12]"},
+			{`map([[1, 2], [3]], fn(a) { map(a, fn(x) { -x }) })`, "[[-1, -2], [-3]]"},
+			{`let f = fn(x) { if (x > 1) { return x; } 0 }; map([1, 2], f)`, "[0, 2]"},
+			{`1 + map([1], fn(x) { x })[0] * 2`, "3"},
+			{`map([1, 2], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+			{`map([1], 1)`, "argument to `map` must be FUNCTION, got INTEGER"},
+			{`map(1, fn(x) { x })`, "argument to `map` must be ARRAY, got INTEGER"},
+			{`map([1], fn() { 1 })`, "wrong number of arguments. got=1, want=0"},
+			{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, "[2, 4]"},
+			{`filter([0, 1, false, "a"], fn(x) { x })`, "[0, 1, a]"},
+			{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x })`, "10"},
+			{`reduce([1, 2, 3], fn(acc, x) { push(acc, x * x) }, [])`, "[1, 4, 9]"},
+			{`reduce([], fn(acc, x) { acc + x }, 0)`, "0"},
+			{`reduce([], fn(acc, x) { acc + x })`, "reduce of empty array with no initial value"},
+			{`reduce([1], fn(acc, x) { acc })`, "1"},
+			{`reduce([1])`, "wrong number of arguments. got=1, want=2 or 3"},
+			{`sort([3, 1, 2])`, "[1, 2, 3]"},
+			{`sort([2.5, 1, 3n])`, "[1, 2.5, 3]"},
+			{`sort(["pear", "apple", "fig"])`, "[apple, fig, pear]"},
+			{`let a = [3, 1, 2]; sort(a); a`, "[3, 1, 2]"},
+			{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+			{`sort([3, 1, 2], fn(a, b) { b - a })`, "[3, 2, 1]"},
+			{`sort([3, 1, 2, 1], fn(a, b) { (a - b) * 100 })`, "[1, 1, 2, 3]"},
+			{`sort(["b", "a", "c"], fn(a, b) { b < a })`, "[c, b, a]"},
+			{`sort([3, 1, 2], fn(a, b) { if (a == 2) { "no" } else { a < b } })`,
+				"comparator must return BOOLEAN or INTEGER, got STRING"},
+			{`sort([[2, "a"], [1, "b"], [2, "c"], [1, "d"]], fn(a, b) { a[0] < b[0] })`,
+				"[[1, b], [1, d], [2, a], [2, c]]"},
+			{`sort([1, true])`, "type mismatch: BOOLEAN < INTEGER"},
+			{`sort([1, 2], fn(a, b) { "yes" })`, "comparator must return BOOLEAN or INTEGER, got STRING"},
+			{`sort({})`, "argument to `sort` must be ARRAY, got HASH"},
+			{`find([1, 2, 3, 4], fn(x) { x > 2 })`, "3"},
+			{`find([1, 2], fn(x) { x > 2 })`, "null"},
+			{`any([1, 2, 3], fn(x) { x > 2 })`, "true"},
+			{`any([], fn(x) { true })`, "false"},
+			{`any([1, 2], fn(x) { if (x == 1) { true } else { x + true } })`, "true"},
+			{`all([1, 2, 3], fn(x) { x > 0 })`, "true"},
+			{`all([1, 2, 3], fn(x) { x > 1 })`, "false"},
+			{`all([], fn(x) { false })`, "true"},
+			{`all([1, 2], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != tt.expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q",
+						tt.input, tt.expected, errObj.Message)
+				}
 				continue
 			}
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s",
+					tt.input, tt.expected, evaluated.Inspect())
+			}
+		}
+	})
+}
+
+func TestStringBuiltins(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`split("a,b,,c", ",")`, "[a, b, , c]"},
+			{`split("héllo", "")`, "[h, é, l, l, o]"},
+			{`split("  GET /index.html  200 ")`, "[GET, /index.html, 200]"},
+			{`len(split("", ","))`, "1"},
+			{`split(1, ",")`, "argument to `split` must be STRING, got INTEGER"},
+			{`split("a", ",", 1)`, "wrong number of arguments. got=3, want=1 or 2"},
+			{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+			{`join([1, true, "x"], "-")`, "1-true-x"},
+			{`join([], ",")`, ""},
+			{`join("abc", ",")`, "argument to `join` must be ARRAY, got STRING"},
+			{`join(["a"], 1)`, "argument to `join` must be STRING, got INTEGER"},
+			{`trim("  hello \n")`, "hello"},
+			{`trim("xxhixx", "x")`, "hi"},
+			{`upper("héllo")`, "HÉLLO"},
+			{`lower("HeLLo")`, "hello"},
+			{`upper(1)`, "argument to `upper` must be STRING, got INTEGER"},
+			{`replace("a-b-c", "-", "+")`, "a+b+c"},
+			{`replace("abc", "x", "y")`, "abc"},
+			{`replace("abc", "a")`, "wrong number of arguments. got=2, want=3"},
+			{
+				`replace(repeat("x", 1000000), "", repeat("y", 2000))`,
+				"result of `replace` too large: 2001002000 bytes",
+			},
+			{`contains("hello world", "o w")`, "true"},
+			{`contains("hello", "x")`, "false"},
+			{`starts_with("hello", "he")`, "true"},
+			{`starts_with("hello", "lo")`, "false"},
+			{`ends_with("hello", "lo")`, "true"},
+			{`ends_with("hello", 1)`, "argument to `ends_with` must be STRING, got INTEGER"},
+			{`index_of("hello", "l")`, "2"},
+			{`index_of("héllo", "l")`, "2"},
+			{`index_of("hello", "x")`, "-1"},
+			{`let s = "日本語"; s[index_of(s, "語")]`, "語"},
+			{`repeat("ab", 3)`, "ababab"},
+			{`repeat("ab", 0)`, ""},
+			{`repeat("ab", -1)`, "negative repeat count: -1"},
+			{`repeat("ab", 9223372036854775807)`, "repeat count too large: 9223372036854775807"},
+			{`repeat("x", 2000000000)`, "repeat count too large: 2000000000"},
+			{`repeat(1, 2)`, "argument to `repeat` must be STRING, got INTEGER"},
+			{`substr("hello", 1, 3)`, "ell"},
+			{`substr("hello", 2)`, "llo"},
+			{`substr("héllo", 1, 1)`, "é"},
+			{`substr("hello", 3, 10)`, "lo"},
+			{`substr("hello", 10)`, ""},
+			{`substr("hello", -1)`, "negative argument to `substr`: -1"},
+			{`substr("hello", "1")`, "argument to `substr` must be INTEGER, got STRING"},
+			{`format("%s=%d", "x", 42)`, "x=42"},
+			{`format("%.2f %t %x", 3.14159, true, 255)`, "3.14 true ff"},
+			{`format("%d", 123456789012345678901234567890n)`, "123456789012345678901234567890"},
+			{`format("%v and %5s|", [1, 2], "ab")`, "[1, 2] and    ab|"},
+			{`format("100%%")`, "100%"},
+			{`format(1)`, "argument to `format` must be STRING, got INTEGER"},
+			{`format()`, "wrong number of arguments. got=0, want=1 or more"},
+			{`format("%s %d", 1, 2)`, "1 2"},
+			{`format("%5.1f|%-3d|%x", 2, 7, "hi")`, "  2.0|7  |6869"},
+			{`format("%s %s", 1)`, "wrong number of arguments. got=2, want=3"},
+			{`format("%d", 1, 2)`, "wrong number of arguments. got=3, want=2"},
+			{`format("%d", "a")`, "argument to `format` for %d must be INTEGER or BIGINT, got STRING"},
+			{`format("%t", 1)`, "argument to `format` for %t must be BOOLEAN, got INTEGER"},
+			{`format("%T", 1)`, "unsupported verb in `format`: %T"},
+			{`format("%p", [])`, "unsupported verb in `format`: %p"},
+			{`format("%#v", "a")`, "unsupported verb in `format`: %#v"},
+			{`format("%[1]d", 1)`, "unsupported verb in `format`: %["},
+			{`format("%*d", 1, 2)`, "unsupported verb in `format`: %*"},
+			{`format("100%")`, "incomplete verb at the end of the `format` string: %"},
+			{`format("%9999999d", 1)`, "width or precision too large in `format`: %9999999"},
+			{`let line = "2024-01-02 ERROR disk full";
+		  let parts = split(line, " ");
+		  if (parts[1] == "ERROR") { format("%s: %s", lower(parts[1]), join(rest(rest(parts)), " ")) }`,
+				"error: disk full"},
+		}
 
-			if len(array.Elements) != len(expected) {
-				t.Errorf("wrong num of elements. want=%d, got=%d",
-					len(expected), len(array.Elements))
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != tt.expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q",
+						tt.input, tt.expected, errObj.Message)
+				}
 				continue
 			}
-
-			for i, expectedElem := range expected {
-				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result for %q. want=%q, got=%q",
+					tt.input, tt.expected, evaluated.Inspect())
 			}
 		}
-	}
+	})
 }
 
 func TestArrayLiterals(t *testing.T) {
-	input := "[1, 2 * 2, 3 + 3]"
+	forEachBackend(t, func(t *testing.T) {
+		input := "[1, 2 * 2, 3 + 3]"
 
-	evaluated := testEval(input)
-	result, ok := evaluated.(*object.Array)
-	if !ok {
-		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
-	}
+		evaluated := testEval(input)
+		result, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+		}
 
-	if len(result.Elements) != 3 {
-		t.Fatalf("array has wrong num of elements. got=%d",
-			len(result.Elements))
-	}
+		if len(result.Elements) != 3 {
+			t.Fatalf("array has wrong num of elements. got=%d",
+				len(result.Elements))
+		}
 
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
+		testIntegerObject(t, result.Elements[0], 1)
+		testIntegerObject(t, result.Elements[1], 4)
+		testIntegerObject(t, result.Elements[2], 6)
+	})
 }
 
 func TestArrayIndexExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{
-			"[1, 2, 3][0]",
-			1,
-		},
-		{
-			"[1, 2, 3][1]",
-			2,
-		},
-		{
-			"[1, 2, 3][2]",
-			3,
-		},
-		{
-			"let i = 0; [1][i];",
-			1,
-		},
-		{
-			"[1, 2, 3][1 + 1];",
-			3,
-		},
-		{
-			"let myArray = [1, 2, 3]; myArray[2];",
-			3,
-		},
-		{
-			"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
-			6,
-		},
-		{
-			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
-			2,
-		},
-		{
-			"[1, 2, 3][3]",
-			nil,
-		},
-		{
-			"[1, 2, 3][-1]",
-			nil,
-		},
-	}
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{
+				"[1, 2, 3][0]",
+				1,
+			},
+			{
+				"[1, 2, 3][1]",
+				2,
+			},
+			{
+				"[1, 2, 3][2]",
+				3,
+			},
+			{
+				"let i = 0; [1][i];",
+				1,
+			},
+			{
+				"[1, 2, 3][1 + 1];",
+				3,
+			},
+			{
+				"let myArray = [1, 2, 3]; myArray[2];",
+				3,
+			},
+			{
+				"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+				6,
+			},
+			{
+				"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+				2,
+			},
+			{
+				"[1, 2, 3][3]",
+				nil,
+			},
+			{
+				"[1, 2, 3][-1]",
+				nil,
+			},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			integer, ok := tt.expected.(int)
+			if ok {
+				testIntegerObject(t, evaluated, int64(integer))
+			} else {
+				testNullObject(t, evaluated)
+			}
+		}
+	})
+}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		integer, ok := tt.expected.(int)
-		if ok {
-			testIntegerObject(t, evaluated, int64(integer))
-		} else {
-			testNullObject(t, evaluated)
+func TestStringIndexExpressions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{`"abc"[0]`, "a"},
+			{`"héllo"[1]`, "é"},
+			{`"héllo"[2]`, "l"},
+			{`let s = "日本語"; s[len(s) - 1]`, "語"},
+			{`"héllo"[5]`, nil},
+			{`"abc"[-1]`, nil},
 		}
-	}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			expected, ok := tt.expected.(string)
+			if !ok {
+				testNullObject(t, evaluated)
+				continue
+			}
+
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. got=%q, want=%q", str.Value, expected)
+			}
+		}
+	})
 }
 
 func TestHashLiterals(t *testing.T) {
-	input := `let two = "two";
+	forEachBackend(t, func(t *testing.T) {
+		input := `let two = "two";
 	{
 		"one": 10 - 9,
 		two: 1 + 1,
@@ -508,88 +1372,181 @@ func TestHashLiterals(t *testing.T) {
 		false: 6
 	}`
 
-	evaluated := testEval(input)
-	result, ok := evaluated.(*object.Hash)
-	if !ok {
-		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
-	}
+		evaluated := testEval(input)
+		result, ok := evaluated.(*object.Hash)
+		if !ok {
+			t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+		}
 
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
-	}
+		expected := []struct {
+			key   object.Object
+			value int64
+		}{
+			{&object.String{Value: "one"}, 1},
+			{&object.String{Value: "two"}, 2},
+			{&object.String{Value: "three"}, 3},
+			{&object.Integer{Value: 4}, 4},
+			{evaluator.TRUE, 5},
+			{evaluator.FALSE, 6},
+		}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
-	}
+		if result.Len() != len(expected) {
+			t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
+		}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
-		if !ok {
-			t.Errorf("no pair for given key in Pairs")
+		for i, pair := range result.Pairs() {
+			if pair.Key.Inspect() != expected[i].key.Inspect() {
+				t.Errorf("pair %d has wrong key. want=%s, got=%s",
+					i, expected[i].key.Inspect(), pair.Key.Inspect())
+			}
 		}
 
-		testIntegerObject(t, pair.Value, expectedValue)
-	}
+		for _, tt := range expected {
+			pair, ok := result.Get(tt.key)
+			if !ok {
+				t.Errorf("no pair for given key in Pairs")
+			}
+
+			testIntegerObject(t, pair.Value, tt.value)
+		}
+	})
+}
+
+func TestHashOrder(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`{"b": 1, "a": 2, "c": 3}`, "{b: 1, a: 2, c: 3}"},
+			{`{3: 1, 1: 2, 2: 3, 1: 4}`, "{3: 1, 1: 4, 2: 3}"},
+			{`let h = {"b": 1, "a": 2}; h["c"] = 3; h["b"] = 4; h`, "{b: 4, a: 2, c: 3}"},
+			{`let s = ""; for (k, v in {"z": 1, "y": 2, "x": 3}) { s += k; }; s`, "zyx"},
+			{`let h = {"a": 1}; for (k, v in h) { h["b"] = 2; }; h`, "{a: 1, b: 2}"},
+			{
+				`let log = []; let f = fn(x) { log = push(log, x); x };
+			{f(1): f(2), f(3): f(4)}; log`,
+				"[1, 2, 3, 4]",
+			},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s",
+					tt.input, tt.expected, evaluated.Inspect())
+			}
+		}
+	})
+}
+
+func TestSelfContainingCollections(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`let a = [1]; a[0] = a; a`, "[[...]]"},
+			{`let h = {"x": 1}; h["self"] = h; h`, "{x: 1, self: {...}}"},
+			{`let a = [1]; let h = {"a": a}; a[0] = h; [a, h]`, "[[{a: [...]}], {a: [{...}]}]"},
+			{`let b = [2]; [b, b]`, "[[2], [2]]"},
+			{`let a = [1, 2]; a[1] = a; "${a}"`, "[1, [...]]"},
+			{`let a = [1, 2]; a[1] = a; join(a, ";")`, "1;[1, [...]]"},
+			{`let a = [1]; a[0] = a; format("%v", a)`, "[[...]]"},
+			{`let a = [1]; a[0] = a; a[0][0][0] == a`, "true"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s",
+					tt.input, tt.expected, evaluated.Inspect())
+			}
+		}
+	})
 }
 
 func TestHashIndexExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{
-			`{"foo": 5}["foo"]`,
-			5,
-		},
-		{
-			`{"foo": 5}["bar"]`,
-			nil,
-		},
-		{
-			`let key = "foo"; {"foo": 5}[key]`,
-			5,
-		},
-		{
-			`{}["foo"]`,
-			nil,
-		},
-		{
-			`{5: 5}[5]`,
-			5,
-		},
-		{
-			`{true: 5}[true]`,
-			5,
-		},
-		{
-			`{false: 5}[false]`,
-			5,
-		},
-	}
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{
+				`{"foo": 5}["foo"]`,
+				5,
+			},
+			{
+				`{"foo": 5}["bar"]`,
+				nil,
+			},
+			{
+				`let key = "foo"; {"foo": 5}[key]`,
+				5,
+			},
+			{
+				`{}["foo"]`,
+				nil,
+			},
+			{
+				`{5: 5}[5]`,
+				5,
+			},
+			{
+				`{true: 5}[true]`,
+				5,
+			},
+			{
+				`{false: 5}[false]`,
+				5,
+			},
+		}
 
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		integer, ok := tt.expected.(int)
-		if ok {
-			testIntegerObject(t, evaluated, int64(integer))
-		} else {
-			testNullObject(t, evaluated)
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			integer, ok := tt.expected.(int)
+			if ok {
+				testIntegerObject(t, evaluated, int64(integer))
+			} else {
+				testNullObject(t, evaluated)
+			}
 		}
-	}
+	})
 }
 
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		return &object.Error{Message: errors[0]}
+	}
+
+	if backend == "vm" {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return vm.New(comp.Bytecode()).Run(context.Background())
+	}
+
 	env := object.NewEnvironment()
+	return evaluator.Eval(context.Background(), program, env)
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
 
-	return Eval(program, env)
+	return true
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -622,8 +1579,8 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 }
 
 func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != NULL {
-		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+	if obj != evaluator.NULL {
+		t.Errorf("object is not evaluator.NULL. got=%T (%+v)", obj, obj)
 		return false
 	}
 	return true
@@ -0,0 +1,231 @@
+package evaluator
+
+import (
+	"cmp"
+	"monkey/object"
+	"slices"
+)
+
+// The builtins in this file take a function as an argument and call it
+// through an object.Caller, so that they work the same with every backend.
+
+func builtinMap(call object.Caller, args ...object.Object) object.Object {
+	arr, fn, err := arrayAndFunction("map", args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]object.Object, len(arr.Elements))
+	for i, element := range arr.Elements {
+		result := call(fn, element)
+		if isError(result) {
+			return result
+		}
+		elements[i] = result
+	}
+	return &object.Array{Elements: elements}
+}
+
+func builtinFilter(call object.Caller, args ...object.Object) object.Object {
+	arr, fn, err := arrayAndFunction("filter", args)
+	if err != nil {
+		return err
+	}
+
+	elements := []object.Object{}
+	for _, element := range arr.Elements {
+		result := call(fn, element)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			elements = append(elements, element)
+		}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// builtinReduce folds an array from the left. Without an initial value it
+// starts with the first element.
+func builtinReduce(call object.Caller, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+	arr, fn, err := arrayAndFunction("reduce", args[:2])
+	if err != nil {
+		return err
+	}
+
+	elements := arr.Elements
+	var acc object.Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else {
+		if len(elements) == 0 {
+			return newError("reduce of empty array with no initial value")
+		}
+		acc, elements = elements[0], elements[1:]
+	}
+
+	for _, element := range elements {
+		acc = call(fn, acc, element)
+		if isError(acc) {
+			return acc
+		}
+	}
+	return acc
+}
+
+// builtinSort returns a sorted copy of an array. The sort is stable. The
+// optional comparator returns whether its first argument goes before the
+// second, as a boolean or as an integer whose sign orders them; without it
+// elements are ordered by <.
+func builtinSort(call object.Caller, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to `sort` must be ARRAY, got %s", args[0].Type())
+	}
+
+	less := func(a, b object.Object) object.Object {
+		return evalInfixExpression("<", a, b, OverflowWrap)
+	}
+	if len(args) == 2 {
+		if !isCallable(args[1]) {
+			return newError("argument to `sort` must be FUNCTION, got %s", args[1].Type())
+		}
+		less = func(a, b object.Object) object.Object {
+			return call(args[1], a, b)
+		}
+	}
+
+	var err object.Object
+	elements := slices.Clone(arr.Elements)
+	slices.SortStableFunc(elements, func(a, b object.Object) int {
+		if err != nil {
+			return 0
+		}
+		var order int
+		order, err = compareWith(less, a, b)
+		return order
+	})
+	if err != nil {
+		return err
+	}
+	return &object.Array{Elements: elements}
+}
+
+// compareWith compares a and b as cmp.Compare does. less returns whether a
+// goes before b, so when it is false it is called again to tell whether b
+// goes before a.
+func compareWith(less func(a, b object.Object) object.Object, a, b object.Object) (int, object.Object) {
+	result := less(a, b)
+	if boolean, ok := result.(*object.Boolean); ok && !boolean.Value {
+		order, err := comparison(less(b, a))
+		return -order, err
+	}
+	return comparison(result)
+}
+
+// comparison converts the result of a comparator to -1, 0 or +1. A
+// comparator returns true if its first argument goes first, or an integer
+// whose sign orders its arguments.
+func comparison(result object.Object) (int, object.Object) {
+	switch result := result.(type) {
+	case *object.Error:
+		return 0, result
+	case *object.Boolean:
+		if result.Value {
+			return -1, nil
+		}
+		return 0, nil
+	case *object.Integer:
+		return cmp.Compare(result.Value, 0), nil
+	default:
+		return 0, newError("comparator must return BOOLEAN or INTEGER, got %s", result.Type())
+	}
+}
+
+// builtinFind returns the first element for which the function returns a
+// truthy value, or null.
+func builtinFind(call object.Caller, args ...object.Object) object.Object {
+	arr, fn, err := arrayAndFunction("find", args)
+	if err != nil {
+		return err
+	}
+
+	for _, element := range arr.Elements {
+		result := call(fn, element)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			return element
+		}
+	}
+	return NULL
+}
+
+func builtinAny(call object.Caller, args ...object.Object) object.Object {
+	return findTruthiness("any", true, call, args)
+}
+
+func builtinAll(call object.Caller, args ...object.Object) object.Object {
+	return findTruthiness("all", false, call, args)
+}
+
+// findTruthiness reports whether the function returns a value of the given
+// truthiness for any element, stopping at the first one. all is the
+// negation of finding a falsy value.
+func findTruthiness(
+	name string,
+	truthy bool,
+	call object.Caller,
+	args []object.Object,
+) object.Object {
+	arr, fn, err := arrayAndFunction(name, args)
+	if err != nil {
+		return err
+	}
+
+	for _, element := range arr.Elements {
+		result := call(fn, element)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) == truthy {
+			return nativeBoolToBooleanObject(truthy)
+		}
+	}
+	return nativeBoolToBooleanObject(!truthy)
+}
+
+// arrayAndFunction checks the arguments of builtins that take an array and
+// a function.
+func arrayAndFunction(
+	name string,
+	args []object.Object,
+) (*object.Array, object.Object, object.Object) {
+	if len(args) != 2 {
+		return nil, nil, newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, nil, newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return nil, nil, newError("argument to `%s` must be FUNCTION, got %s", name, args[1].Type())
+	}
+	return arr, args[1], nil
+}
+
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Closure, *object.Builtin:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,74 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"slices"
+)
+
+// Iterator steps through the elements of an array, hash or string for a
+// for loop.
+type Iterator struct {
+	length int
+	index  int
+	at     func(i int) (key, value object.Object)
+	isHash bool
+}
+
+// Iterators are objects so that the vm can keep them in variables.
+func (it *Iterator) Type() object.ObjectType { return object.ITERATOR_OBJ }
+func (it *Iterator) Inspect() string         { return "iterator" }
+
+// NewIterator returns an iterator over iterable or an error if it can't be
+// iterated.
+func NewIterator(iterable object.Object) (*Iterator, *object.Error) {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		return &Iterator{
+			length: len(iterable.Elements),
+			at: func(i int) (object.Object, object.Object) {
+				return &object.Integer{Value: int64(i)}, iterable.Elements[i]
+			},
+		}, nil
+
+	case *object.Hash:
+		// A copy, so that assignments in the loop don't change the pairs
+		// being iterated.
+		pairs := slices.Clone(iterable.Pairs())
+		return &Iterator{
+			length: len(pairs),
+			at: func(i int) (object.Object, object.Object) {
+				return pairs[i].Key, pairs[i].Value
+			},
+			isHash: true,
+		}, nil
+
+	case *object.String:
+		chars := []rune(iterable.Value)
+		return &Iterator{
+			length: len(chars),
+			at: func(i int) (object.Object, object.Object) {
+				return &object.Integer{Value: int64(i)}, &object.String{Value: string(chars[i])}
+			},
+		}, nil
+
+	default:
+		return nil, newError("cannot iterate over %s", iterable.Type())
+	}
+}
+
+// Next returns the next key and value, where the key is the index for
+// arrays and strings. Without withKey, the value of a hash is its
+// [key, value] pair. ok is false when there are no more elements.
+func (it *Iterator) Next(withKey bool) (key, value object.Object, ok bool) {
+	if it.index >= it.length {
+		return nil, nil, false
+	}
+
+	key, value = it.at(it.index)
+	it.index++
+
+	if it.isHash && !withKey {
+		value = &object.Array{Elements: []object.Object{key, value}}
+	}
+	return key, value, true
+}
@@ -0,0 +1,123 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"monkey/object"
+)
+
+// DefaultMaxDepth is the call depth allowed when Limits.MaxDepth is zero.
+const DefaultMaxDepth = 1024
+
+// contextCheckInterval is the number of steps between checks of the
+// context, which are too slow to do on every step.
+const contextCheckInterval = 1024
+
+// Limits caps the resources that a program may use. A zero field means no
+// limit, except for MaxDepth, which defaults to DefaultMaxDepth so that
+// deep recursion can't overflow the Go stack.
+type Limits struct {
+	// MaxSteps caps the number of evaluated nodes or, in the vm, executed
+	// instructions.
+	MaxSteps int
+
+	// MaxDepth caps the number of active calls, counting the program
+	// itself as one.
+	MaxDepth int
+
+	// MaxAllocations caps the number of objects created, weighted by their
+	// size: arrays and hashes count one more for each element, strings one
+	// more for each 8 bytes and big integers one more for each word.
+	MaxAllocations int
+}
+
+// Meter measures the resources used by a program against its Limits and
+// the cancellation of its context.
+type Meter struct {
+	ctx         context.Context
+	limits      Limits
+	steps       int
+	allocations int
+}
+
+func NewMeter(ctx context.Context, limits Limits) *Meter {
+	if limits.MaxDepth == 0 {
+		limits.MaxDepth = DefaultMaxDepth
+	}
+	return &Meter{ctx: ctx, limits: limits}
+}
+
+func (m *Meter) MaxDepth() int { return m.limits.MaxDepth }
+
+// Step counts one step of the program and returns an error once the step
+// limit is exceeded or the context is done.
+func (m *Meter) Step() *object.Error {
+	m.steps++
+
+	if m.limits.MaxSteps > 0 && m.steps > m.limits.MaxSteps {
+		return newLimitError(nil, "step limit of %d exceeded", m.limits.MaxSteps)
+	}
+
+	if m.steps%contextCheckInterval == 0 {
+		return m.CheckContext()
+	}
+	return nil
+}
+
+// CheckContext returns an error if the context is done.
+func (m *Meter) CheckContext() *object.Error {
+	if err := m.ctx.Err(); err != nil {
+		return newLimitError(err, "%s", err)
+	}
+	return nil
+}
+
+// Allocate counts obj as created and returns an error once the allocation
+// limit is exceeded.
+func (m *Meter) Allocate(obj object.Object) *object.Error {
+	if m.limits.MaxAllocations == 0 {
+		return nil
+	}
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		return m.Grow(1 + len(obj.Elements))
+	case *object.Hash:
+		return m.Grow(1 + obj.Len())
+	case *object.String:
+		return m.Grow(1 + len(obj.Value)/8)
+	case *object.BigInt:
+		return m.Grow(1 + len(obj.Value.Bits()))
+	case *object.Error, *object.Null, *object.Boolean, nil:
+		return nil
+	default:
+		return m.Grow(1)
+	}
+}
+
+// Grow counts n elements added to an array or hash that was already
+// counted, and returns an error once the allocation limit is exceeded.
+func (m *Meter) Grow(n int) *object.Error {
+	if m.limits.MaxAllocations == 0 {
+		return nil
+	}
+
+	m.allocations += n
+	if m.allocations > m.limits.MaxAllocations {
+		return newLimitError(nil, "allocation limit of %d exceeded", m.limits.MaxAllocations)
+	}
+	return nil
+}
+
+// StackOverflow returns the error for exceeding the call depth.
+func StackOverflow() *object.Error {
+	return newLimitError(nil, "stack overflow")
+}
+
+func newLimitError(cause error, format string, a ...interface{}) *object.Error {
+	return &object.Error{
+		Message: fmt.Sprintf(format, a...),
+		Kind:    object.LimitError,
+		Cause:   cause,
+	}
+}
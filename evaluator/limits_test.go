@@ -0,0 +1,212 @@
+package evaluator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"strings"
+	"testing"
+)
+
+const fib = `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(15);
+`
+
+func TestLimits(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input           string
+			limits          evaluator.Limits
+			expectedMessage string
+		}{
+			{"let f = fn() { f() }; f()", evaluator.Limits{}, "stack overflow"},
+			{
+				"let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(20)",
+				evaluator.Limits{MaxDepth: 10},
+				"stack overflow",
+			},
+			{fib, evaluator.Limits{MaxSteps: 100}, "step limit of 100 exceeded"},
+			{
+				"[1, 2, 3, 4, 5, 6, 7, 8, 9, 10]",
+				evaluator.Limits{MaxAllocations: 5},
+				"allocation limit of 5 exceeded",
+			},
+			{
+				"let f = fn(a) { if (len(a) < 100) { f(push(a, 1)) } else { a } }; f([])",
+				evaluator.Limits{MaxAllocations: 1000},
+				"allocation limit of 1000 exceeded",
+			},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEvalWithConfig(context.Background(), tt.input,
+				evaluator.Config{Limits: tt.limits})
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Kind != object.LimitError {
+				t.Errorf("wrong error kind for %q. got=%d", errObj.Message, errObj.Kind)
+			}
+
+			if errObj.Message != tt.expectedMessage {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					tt.expectedMessage, errObj.Message)
+			}
+		}
+	})
+}
+
+// TestAllocationSizes checks that large strings and big integers count
+// against the allocation limit by their size.
+func TestAllocationSizes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []string{
+			`let s = "x"; while (true) { s = s + s }`,
+			`let x = 3; while (true) { x = x * x }`,
+			`let s = "x"; while (true) { s = "${s}${s}" }`,
+			`repeat("abcdefgh", 1000000)`,
+		}
+
+		config := evaluator.Config{
+			Limits:   evaluator.Limits{MaxAllocations: 100000},
+			Overflow: evaluator.OverflowPromote,
+		}
+		for _, input := range tests {
+			evaluated := testEvalWithConfig(context.Background(), input, config)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != "allocation limit of 100000 exceeded" {
+				t.Errorf("expected allocation limit error for %q. got=%T(%+v)",
+					input, evaluated, evaluated)
+			}
+		}
+	})
+}
+
+func TestWithinLimits(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		limits := evaluator.Limits{MaxSteps: 1000000, MaxDepth: 20, MaxAllocations: 100000}
+		evaluated := testEvalWithConfig(context.Background(), fib, evaluator.Config{Limits: limits})
+		testIntegerObject(t, evaluated, 610)
+
+		evaluated = testEval("1 + true")
+		if errObj, ok := evaluated.(*object.Error); !ok || errObj.Kind != object.RuntimeError {
+			t.Errorf("expected runtime error. got=%T(%+v)", evaluated, evaluated)
+		}
+	})
+}
+
+func TestContextCancellation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		evaluated := testEvalWithConfig(ctx, fib, evaluator.Config{})
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+		}
+
+		if errObj.Kind != object.LimitError {
+			t.Errorf("wrong error kind. got=%d", errObj.Kind)
+		}
+
+		if !errors.Is(errObj, context.Canceled) {
+			t.Errorf("error does not wrap context.Canceled. got=%v", errObj.Cause)
+		}
+	})
+}
+
+// TestLargePrograms checks programs whose bytecode needs operands that
+// don't fit in a byte or in two.
+func TestLargePrograms(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		increments := strings.Repeat("x = x + 1; ", 8000)
+		testIntegerObject(t, testEval("let x = 0; if (true) { "+increments+"}; x"), 8000)
+
+		// identifiers can't contain digits
+		name := func(i int) string {
+			return fmt.Sprintf("v%c%c", 'a'+i/26, 'a'+i%26)
+		}
+
+		var locals, params, args []string
+		for i := 0; i < 300; i++ {
+			locals = append(locals, fmt.Sprintf("let %s = %d;", name(i), i))
+		}
+		for i := 0; i < 256; i++ {
+			params = append(params, name(i))
+			args = append(args, fmt.Sprint(i))
+		}
+
+		input := fmt.Sprintf("fn() { %s %s - %s + %s }()",
+			strings.Join(locals, " "), name(299), name(0), name(256))
+		testIntegerObject(t, testEval(input), 555)
+
+		input = fmt.Sprintf("fn(%s) { %s + %s }(%s)",
+			strings.Join(params, ", "), name(0), name(255), strings.Join(args, ", "))
+		testIntegerObject(t, testEval(input), 255)
+	})
+}
+
+// TestLargeValues checks values and calls that need more stack than a
+// small program.
+func TestLargeValues(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		var elements, pairs []string
+		for i := 0; i < 3000; i++ {
+			elements = append(elements, fmt.Sprint(i))
+			pairs = append(pairs, fmt.Sprintf("%d: %d", i, i))
+		}
+
+		input := "let a = [" + strings.Join(elements, ", ") + "]; a[2999] + len(a)"
+		testIntegerObject(t, testEval(input), 5999)
+
+		input = "let h = {" + strings.Join(pairs, ", ") + "}; h[2999] + len(h)"
+		testIntegerObject(t, testEval(input), 5999)
+
+		strs := `"s"` + strings.Repeat(`, "s"`, 69999)
+		testIntegerObject(t, testEval("len(["+strs+"])"), 70000)
+
+		input = `
+let f = fn(n) {
+  let a = n; let b = a; let c = b;
+  if (c == 0) { 0 } else { f(n - 1) + 1 }
+};
+f(900);
+`
+		testIntegerObject(t, testEval(input), 900)
+
+		input = "[" + strings.Join(elements, ", ") + "]"
+		evaluated := testEvalWithConfig(context.Background(), input,
+			evaluator.Config{Limits: evaluator.Limits{MaxAllocations: 1000}})
+		if errObj, ok := evaluated.(*object.Error); !ok || errObj.Kind != object.LimitError {
+			t.Errorf("expected limit error. got=%T(%+v)", evaluated, evaluated)
+		}
+	})
+}
+
+func testEvalWithConfig(ctx context.Context, input string, config evaluator.Config) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	if backend == "vm" {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return vm.NewWithConfig(comp.Bytecode(), make([]object.Object, vm.GlobalSize), config).Run(ctx)
+	}
+
+	return evaluator.EvalWithConfig(ctx, program, object.NewEnvironment(), config)
+}
@@ -0,0 +1,106 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+)
+
+func (e *evaluation) quote(call *ast.CallExpression, env *object.Environment) object.Object {
+	if len(call.Arguments) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(call.Arguments))
+	}
+
+	node, err := Unquote(call.Arguments[0], func(argument ast.Expression) object.Object {
+		return e.Eval(argument, env)
+	})
+	if err != nil {
+		return err
+	}
+
+	return &object.Quote{Node: node}
+}
+
+// Unquote returns a copy of node in which every call of unquote is replaced
+// by the AST node of the value that valueOf returns for the argument of the
+// call. Calls are visited in the order of ast.Modify.
+func Unquote(
+	node ast.Node,
+	valueOf func(argument ast.Expression) object.Object,
+) (ast.Node, *object.Error) {
+	var err *object.Error
+
+	modified := ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if err != nil || !ok || !IsUnquoteCall(call) {
+			return node
+		}
+
+		if len(call.Arguments) != 1 {
+			err = newError("wrong number of arguments. got=%d, want=1", len(call.Arguments))
+			return node
+		}
+
+		value := valueOf(call.Arguments[0])
+		if errObj, ok := value.(*object.Error); ok {
+			err = errObj
+			return node
+		}
+
+		converted := convertObjectToASTNode(value, call.Span())
+		if converted == nil {
+			err = newError("cannot unquote %s", value.Type())
+			return node
+		}
+		return converted
+	})
+
+	return modified, err
+}
+
+func IsUnquoteCall(call *ast.CallExpression) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "unquote"
+}
+
+// convertObjectToASTNode returns nil if obj can't be represented as a node.
+// The node gets the span of the unquote call it replaces.
+func convertObjectToASTNode(obj object.Object, span token.Span) ast.Node {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: strconv.FormatInt(obj.Value, 10),
+			Span:    span,
+		}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+
+	case *object.BigInt:
+		t := token.Token{Type: token.BIGINT, Literal: obj.Inspect() + "n", Span: span}
+		return &ast.BigIntegerLiteral{Token: t, Value: obj.Value}
+
+	case *object.Float:
+		t := token.Token{Type: token.FLOAT, Literal: obj.Inspect(), Span: span}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}
+
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value, Span: span}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}
+
+	case *object.Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true", Span: span}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false", Span: span}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}
+
+	case *object.Quote:
+		return obj.Node
+
+	default:
+		return nil
+	}
+}
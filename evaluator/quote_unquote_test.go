@@ -0,0 +1,104 @@
+package evaluator_test
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`quote(5)`, `5`},
+			{`quote(5 + 8)`, `(5 + 8)`},
+			{`quote(foobar)`, `foobar`},
+			{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		}
+
+		for _, tt := range tests {
+			testQuoteObject(t, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`quote(unquote(4))`, `4`},
+			{`quote(unquote(4 + 4))`, `8`},
+			{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+			{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+			{`let foobar = 8; quote(foobar)`, `foobar`},
+			{`let foobar = 8; quote(unquote(foobar))`, `8`},
+			{`quote(unquote(true))`, `true`},
+			{`quote(unquote(true == false))`, `false`},
+			{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+			{`quote(unquote("hello"))`, `hello`},
+			{
+				`let quotedInfixExpression = quote(4 + 4);
+			quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
+				`(8 + (4 + 4))`,
+			},
+			{
+				`let f = fn(x) { quote(x + unquote(x)) }; f(1); f(2)`,
+				`(x + 2)`,
+			},
+		}
+
+		for _, tt := range tests {
+			testQuoteObject(t, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestUnquoteErrors(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		tests := []struct {
+			input           string
+			expectedMessage string
+		}{
+			{`quote(unquote(fn(x) { x }))`, "cannot unquote FUNCTION"},
+			{`quote(unquote(foobar))`, "identifier not found: foobar"},
+			{`unquote(1)`, "identifier not found: unquote"},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != tt.expectedMessage {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					tt.expectedMessage, errObj.Message)
+			}
+		}
+	})
+}
+
+func testQuoteObject(t *testing.T, obj object.Object, expected string) {
+	t.Helper()
+
+	quote, ok := obj.(*object.Quote)
+	if !ok {
+		t.Errorf("expected *object.Quote. got=%T (%+v)", obj, obj)
+		return
+	}
+
+	if quote.Node == nil {
+		t.Errorf("quote.Node is nil")
+		return
+	}
+
+	if quote.Node.String() != expected {
+		t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+	}
+}
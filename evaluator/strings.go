@@ -0,0 +1,382 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Positions and lengths taken and returned by the string builtins count
+// characters, as indexing does.
+
+// maxStringSize caps the size in bytes of the strings made by builtins
+// whose result can be much larger than their arguments. Such a string is
+// made before the allocation limit can count it.
+const maxStringSize = 1 << 30
+
+// builtinSplit splits a string around each instance of a separator. Without
+// a separator it splits around runs of white space.
+func builtinSplit(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	strs, err := stringArguments("split", args)
+	if err != nil {
+		return err
+	}
+
+	var fields []string
+	if len(strs) == 1 {
+		fields = strings.Fields(strs[0])
+	} else {
+		fields = strings.Split(strs[0], strs[1])
+	}
+
+	elements := make([]object.Object, len(fields))
+	for i, field := range fields {
+		elements[i] = &object.String{Value: field}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// builtinJoin concatenates the elements of an array with a separator
+// between them. Elements that are not strings are formatted as in string
+// interpolation.
+func builtinJoin(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to `join` must be ARRAY, got %s", args[0].Type())
+	}
+	sep, ok := args[1].(*object.String)
+	if !ok {
+		return newError("argument to `join` must be STRING, got %s", args[1].Type())
+	}
+
+	parts := make([]string, len(arr.Elements))
+	for i, element := range arr.Elements {
+		parts[i] = element.Inspect()
+	}
+	return &object.String{Value: strings.Join(parts, sep.Value)}
+}
+
+// builtinTrim removes leading and trailing white space, or the characters
+// in its second argument.
+func builtinTrim(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	strs, err := stringArguments("trim", args)
+	if err != nil {
+		return err
+	}
+
+	if len(strs) == 1 {
+		return &object.String{Value: strings.TrimSpace(strs[0])}
+	}
+	return &object.String{Value: strings.Trim(strs[0], strs[1])}
+}
+
+func builtinUpper(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	strs, err := stringArguments("upper", args)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: strings.ToUpper(strs[0])}
+}
+
+func builtinLower(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	strs, err := stringArguments("lower", args)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: strings.ToLower(strs[0])}
+}
+
+// builtinReplace replaces all instances of old with new.
+func builtinReplace(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3", len(args))
+	}
+	strs, err := stringArguments("replace", args)
+	if err != nil {
+		return err
+	}
+
+	matches := strings.Count(strs[0], strs[1])
+	if size := len(strs[0]) + matches*(len(strs[2])-len(strs[1])); size > maxStringSize {
+		return newError("result of `replace` too large: %d bytes", size)
+	}
+	return &object.String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+}
+
+func builtinContains(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	strs, err := stringArguments("contains", args)
+	if err != nil {
+		return err
+	}
+	return nativeBoolToBooleanObject(strings.Contains(strs[0], strs[1]))
+}
+
+func builtinStartsWith(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	strs, err := stringArguments("starts_with", args)
+	if err != nil {
+		return err
+	}
+	return nativeBoolToBooleanObject(strings.HasPrefix(strs[0], strs[1]))
+}
+
+func builtinEndsWith(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	strs, err := stringArguments("ends_with", args)
+	if err != nil {
+		return err
+	}
+	return nativeBoolToBooleanObject(strings.HasSuffix(strs[0], strs[1]))
+}
+
+// builtinIndexOf returns the position of the first instance of a substring,
+// or -1 if there is none.
+func builtinIndexOf(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	strs, err := stringArguments("index_of", args)
+	if err != nil {
+		return err
+	}
+
+	index := strings.Index(strs[0], strs[1])
+	if index < 0 {
+		return &object.Integer{Value: -1}
+	}
+	return &object.Integer{Value: int64(utf8.RuneCountInString(strs[0][:index]))}
+}
+
+func builtinRepeat(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `repeat` must be STRING, got %s", args[0].Type())
+	}
+	count, ok := args[1].(*object.Integer)
+	if !ok {
+		return newError("argument to `repeat` must be INTEGER, got %s", args[1].Type())
+	}
+
+	switch {
+	case count.Value < 0:
+		return newError("negative repeat count: %d", count.Value)
+	case count.Value > 0 && int64(len(str.Value)) > maxStringSize/count.Value:
+		return newError("repeat count too large: %d", count.Value)
+	}
+	return &object.String{Value: strings.Repeat(str.Value, int(count.Value))}
+}
+
+// builtinSubstr returns the part of a string that starts at a position and
+// has at most the given length, or runs to the end of the string.
+func builtinSubstr(args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `substr` must be STRING, got %s", args[0].Type())
+	}
+	bounds := make([]int64, len(args)-1)
+	for i, arg := range args[1:] {
+		integer, ok := arg.(*object.Integer)
+		if !ok {
+			return newError("argument to `substr` must be INTEGER, got %s", arg.Type())
+		}
+		if integer.Value < 0 {
+			return newError("negative argument to `substr`: %d", integer.Value)
+		}
+		bounds[i] = integer.Value
+	}
+
+	runes := []rune(str.Value)
+	start := min(bounds[0], int64(len(runes)))
+	end := int64(len(runes))
+	if len(bounds) == 2 && bounds[1] < end-start {
+		end = start + bounds[1]
+	}
+	return &object.String{Value: string(runes[start:end])}
+}
+
+// builtinFormat formats its arguments according to a format string as
+// fmt.Sprintf does. Each verb must have an argument of a type it can
+// format: %v, %s and %q take any value, formatting values other than
+// numbers and booleans as in string interpolation. Verbs that would show
+// Go types or pointers aren't supported.
+func builtinFormat(args ...object.Object) object.Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want=1 or more", len(args))
+	}
+	format, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `format` must be STRING, got %s", args[0].Type())
+	}
+
+	verbs, err := parseFormat(format.Value)
+	if err != nil {
+		return err
+	}
+	if len(args) != len(verbs)+1 {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), len(verbs)+1)
+	}
+
+	values := make([]interface{}, len(verbs))
+	for i, verb := range verbs {
+		value, err := formatValue(verb, args[i+1])
+		if err != nil {
+			return err
+		}
+		values[i] = value
+	}
+	return &object.String{Value: fmt.Sprintf(format.Value, values...)}
+}
+
+// formatVerbTypes lists the verbs that take only some types of values.
+// Integers are converted for the floating point verbs.
+var formatVerbTypes = map[rune][]object.ObjectType{
+	'd': {object.INTEGER_OBJ, object.BIGINT_OBJ},
+	'b': {object.INTEGER_OBJ, object.BIGINT_OBJ},
+	'o': {object.INTEGER_OBJ, object.BIGINT_OBJ},
+	'x': {object.INTEGER_OBJ, object.BIGINT_OBJ, object.STRING_OBJ},
+	'X': {object.INTEGER_OBJ, object.BIGINT_OBJ, object.STRING_OBJ},
+	'c': {object.INTEGER_OBJ},
+	'e': {object.FLOAT_OBJ, object.INTEGER_OBJ},
+	'E': {object.FLOAT_OBJ, object.INTEGER_OBJ},
+	'f': {object.FLOAT_OBJ, object.INTEGER_OBJ},
+	'F': {object.FLOAT_OBJ, object.INTEGER_OBJ},
+	'g': {object.FLOAT_OBJ, object.INTEGER_OBJ},
+	'G': {object.FLOAT_OBJ, object.INTEGER_OBJ},
+	't': {object.BOOLEAN_OBJ},
+}
+
+// maxFormatWidth is the largest width or precision fmt accepts.
+const maxFormatWidth = 1000000
+
+// parseFormat returns the verbs of a format string that take an argument,
+// in order. It returns an error for verbs that aren't supported, including
+// the explicit argument indexes and the * widths of fmt.
+func parseFormat(format string) ([]rune, object.Object) {
+	var verbs []rune
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+
+		start := i
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+		flags := format[start+1 : i]
+
+		var ok bool
+		if i, ok = skipFormatNumber(format, i); ok && i < len(format) && format[i] == '.' {
+			i, ok = skipFormatNumber(format, i+1)
+		}
+		if !ok {
+			return nil, newError("width or precision too large in `format`: %s", format[start:i])
+		}
+		if i == len(format) {
+			return nil, newError("incomplete verb at the end of the `format` string: %s", format[start:])
+		}
+
+		verb, size := utf8.DecodeRuneInString(format[i:])
+		i += size - 1
+		if verb == '%' {
+			continue
+		}
+
+		_, typed := formatVerbTypes[verb]
+		supported := typed || verb == 's' || verb == 'q' ||
+			verb == 'v' && !strings.Contains(flags, "#")
+		if !supported {
+			return nil, newError("unsupported verb in `format`: %s", format[start:i+1])
+		}
+		verbs = append(verbs, verb)
+	}
+	return verbs, nil
+}
+
+// skipFormatNumber returns the position after the digits at position i and
+// whether the number they make is a valid width or precision.
+func skipFormatNumber(format string, i int) (int, bool) {
+	n := 0
+	for ; i < len(format) && '0' <= format[i] && format[i] <= '9'; i++ {
+		if n <= maxFormatWidth {
+			n = n*10 + int(format[i]-'0')
+		}
+	}
+	return i, n <= maxFormatWidth
+}
+
+// formatValue converts arg to the Go value that fmt formats with verb.
+func formatValue(verb rune, arg object.Object) (interface{}, object.Object) {
+	if types, ok := formatVerbTypes[verb]; ok && !slices.Contains(types, arg.Type()) {
+		names := make([]string, len(types))
+		for i, t := range types {
+			names[i] = string(t)
+		}
+		return nil, newError("argument to `format` for %%%c must be %s, got %s",
+			verb, strings.Join(names, " or "), arg.Type())
+	}
+
+	if verb == 's' || verb == 'q' {
+		return arg.Inspect(), nil
+	}
+
+	switch arg := arg.(type) {
+	case *object.Integer:
+		if strings.ContainsRune("eEfFgG", verb) {
+			return float64(arg.Value), nil
+		}
+		return arg.Value, nil
+	case *object.BigInt:
+		return arg.Value, nil
+	case *object.Float:
+		return arg.Value, nil
+	case *object.Boolean:
+		return arg.Value, nil
+	default:
+		return arg.Inspect(), nil
+	}
+}
+
+// stringArguments checks that all arguments are strings and returns their
+// values.
+func stringArguments(name string, args []object.Object) ([]string, object.Object) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(*object.String)
+		if !ok {
+			return nil, newError("argument to `%s` must be STRING, got %s", name, arg.Type())
+		}
+		strs[i] = str.Value
+	}
+	return strs, nil
+}
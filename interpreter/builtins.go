@@ -0,0 +1,22 @@
+package interpreter
+
+import (
+	"fmt"
+	"monkey/object"
+)
+
+func newBuiltinArgs(args []string) object.BuiltinFunction {
+	return func(arguments ...object.Object) object.Object {
+		if len(arguments) != 0 {
+			return &object.Error{Message: fmt.Sprintf(
+				"wrong number of arguments. got=%d, want=0", len(arguments))}
+		}
+
+		elements := make([]object.Object, len(args))
+		for i, arg := range args {
+			elements[i] = &object.String{Value: arg}
+		}
+
+		return &object.Array{Elements: elements}
+	}
+}
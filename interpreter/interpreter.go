@@ -0,0 +1,233 @@
+// Package interpreter embeds Monkey in Go programs. Each Interpreter has its
+// own output, builtins and global variables, so several of them can be used
+// independently in one process.
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"strings"
+)
+
+// Engines that can execute Monkey programs.
+const (
+	EngineEval = "eval"
+	EngineVM   = "vm"
+)
+
+// Options configures a new Interpreter. The zero value runs programs with
+// the evaluator and writes to os.Stdout and os.Stderr.
+type Options struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	Engine string
+	Limits evaluator.Limits
+
+	// Overflow is the policy for integer overflow, by default
+	// evaluator.OverflowWrap.
+	Overflow evaluator.Overflow
+
+	// Args are returned by the args builtin.
+	Args []string
+}
+
+type Interpreter struct {
+	stdout   io.Writer
+	stderr   io.Writer
+	engine   string
+	limits   evaluator.Limits
+	overflow evaluator.Overflow
+	builtins map[string]*object.Builtin
+
+	env      *object.Environment
+	macroEnv *object.Environment
+
+	// State of the virtual machine, kept between runs.
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
+func New(opts Options) (*Interpreter, error) {
+	i := &Interpreter{
+		stdout:   opts.Stdout,
+		stderr:   opts.Stderr,
+		engine:   opts.Engine,
+		limits:   opts.Limits,
+		overflow: opts.Overflow,
+		env:      object.NewEnvironment(),
+		macroEnv: object.NewEnvironment(),
+	}
+
+	if i.stdout == nil {
+		i.stdout = os.Stdout
+	}
+	if i.stderr == nil {
+		i.stderr = os.Stderr
+	}
+
+	switch i.engine {
+	case "":
+		i.engine = EngineEval
+	case EngineEval:
+	case EngineVM:
+		i.symbolTable = compiler.NewSymbolTable()
+		i.constants = []object.Object{}
+		i.globals = make([]object.Object, vm.GlobalSize)
+	default:
+		return nil, fmt.Errorf("unknown engine %q", opts.Engine)
+	}
+
+	if !i.overflow.IsValid() {
+		return nil, fmt.Errorf("unknown overflow policy %q", opts.Overflow)
+	}
+
+	i.builtins = evaluator.NewBuiltins(i.stdout)
+	i.RegisterBuiltin("args", newBuiltinArgs(opts.Args))
+
+	return i, nil
+}
+
+func (i *Interpreter) Stdout() io.Writer { return i.stdout }
+func (i *Interpreter) Stderr() io.Writer { return i.stderr }
+
+// RegisterBuiltin adds a builtin function to the programs run by i. It
+// replaces the builtin of the same name, if any.
+func (i *Interpreter) RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	i.builtins[name] = &object.Builtin{Fn: fn}
+}
+
+// RegisterHigherOrderBuiltin is like RegisterBuiltin for a builtin that
+// calls functions it is passed, through the object.Caller it is given.
+func (i *Interpreter) RegisterHigherOrderBuiltin(name string, fn object.HigherOrderFunction) {
+	i.builtins[name] = &object.Builtin{HigherOrderFn: fn}
+}
+
+// Run runs the program src and returns the value of its last expression
+// statement. Global variables defined by src are visible to later runs.
+//
+// The program is stopped when ctx is done or it exceeds the limits of i,
+// in which case the error is an *object.Error of kind object.LimitError.
+func (i *Interpreter) Run(ctx context.Context, src string) (object.Object, error) {
+	return i.RunFile(ctx, "", src)
+}
+
+// RunFile is like Run but uses filename in positions.
+//
+// Syntax errors are returned as *SyntaxError and runtime errors as
+// *object.Error.
+func (i *Interpreter) RunFile(
+	ctx context.Context,
+	filename string,
+	src string,
+) (object.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.NewWithFilename(filename, src))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		return nil, &SyntaxError{Diagnostics: p.Diagnostics()}
+	}
+
+	evaluator.DefineMacros(program, i.macroEnv)
+	expanded, err := evaluator.ExpandMacrosWithConfig(ctx, program, i.macroEnv, i.config())
+	if err != nil {
+		return nil, err
+	}
+
+	var result object.Object
+	if i.engine == EngineVM {
+		comp := compiler.NewWithState(i.symbolTable, i.constants)
+		if err := comp.Compile(expanded); err != nil {
+			return nil, err
+		}
+
+		bytecode := comp.Bytecode()
+		i.constants = bytecode.Constants
+		result = vm.NewWithConfig(bytecode, i.globals, i.config()).Run(ctx)
+	} else {
+		result = evaluator.EvalWithConfig(ctx, expanded.(*ast.Program), i.env, i.config())
+	}
+
+	return unwrapResult(result)
+}
+
+// Call calls the global function or builtin fnName with args.
+func (i *Interpreter) Call(fnName string, args ...object.Object) (object.Object, error) {
+	return i.CallContext(context.Background(), fnName, args...)
+}
+
+// CallContext is like Call but stops the function when ctx is done.
+func (i *Interpreter) CallContext(
+	ctx context.Context,
+	fnName string,
+	args ...object.Object,
+) (object.Object, error) {
+	if i.engine == EngineVM {
+		fn, ok := i.vmGlobal(fnName)
+		if !ok {
+			return nil, fmt.Errorf("undefined function %q", fnName)
+		}
+
+		bytecode := &compiler.Bytecode{
+			Constants:   i.constants,
+			GlobalNames: i.symbolTable.GlobalNames(),
+		}
+		machine := vm.NewWithConfig(bytecode, i.globals, i.config())
+		return unwrapResult(machine.Call(ctx, fn, args...))
+	}
+
+	fn, ok := i.env.Get(fnName)
+	if !ok {
+		fn, ok = i.builtins[fnName]
+	}
+	if !ok {
+		return nil, fmt.Errorf("undefined function %q", fnName)
+	}
+	return unwrapResult(evaluator.Apply(ctx, fn, args, i.config()))
+}
+
+func (i *Interpreter) vmGlobal(name string) (object.Object, bool) {
+	symbol, ok := i.symbolTable.Resolve(name)
+	if ok && symbol.Scope == compiler.GlobalScope && i.globals[symbol.Index] != nil {
+		return i.globals[symbol.Index], true
+	}
+
+	builtin, ok := i.builtins[name]
+	return builtin, ok
+}
+
+func (i *Interpreter) config() evaluator.Config {
+	return evaluator.Config{Builtins: i.builtins, Limits: i.limits, Overflow: i.overflow}
+}
+
+func unwrapResult(result object.Object) (object.Object, error) {
+	if err, ok := result.(*object.Error); ok {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SyntaxError is returned for programs that could not be parsed.
+type SyntaxError struct {
+	Diagnostics []parser.Diagnostic
+}
+
+func (e *SyntaxError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = d.String()
+	}
+	return strings.Join(messages, "\n")
+}
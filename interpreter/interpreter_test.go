@@ -0,0 +1,240 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"monkey/evaluator"
+	"monkey/object"
+	"testing"
+	"time"
+)
+
+var engines = []string{EngineEval, EngineVM}
+
+func newTestInterpreter(t *testing.T, engine string, stdout *bytes.Buffer) *Interpreter {
+	t.Helper()
+
+	interp, err := New(Options{Stdout: stdout, Engine: engine})
+	if err != nil {
+		t.Fatalf("New returned error: %s", err)
+	}
+	return interp
+}
+
+func TestRun(t *testing.T) {
+	for _, engine := range engines {
+		var out bytes.Buffer
+		interp := newTestInterpreter(t, engine, &out)
+
+		result, err := interp.Run(context.Background(), `puts("hello"); let x = 5; x * 2`)
+		if err != nil {
+			t.Fatalf("%s: Run returned error: %s", engine, err)
+		}
+		if result.Inspect() != "10" {
+			t.Errorf("%s: wrong result. want=10, got=%s", engine, result.Inspect())
+		}
+		if out.String() != "hello\n" {
+			t.Errorf("%s: wrong output. want=%q, got=%q", engine, "hello\n", out.String())
+		}
+
+		result, err = interp.Run(context.Background(), "x + 1")
+		if err != nil {
+			t.Fatalf("%s: Run returned error: %s", engine, err)
+		}
+		if result.Inspect() != "6" {
+			t.Errorf("%s: globals not kept between runs. want=6, got=%s",
+				engine, result.Inspect())
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, engine := range engines {
+		interp := newTestInterpreter(t, engine, &bytes.Buffer{})
+
+		_, err := interp.Run(context.Background(), "let = 1;")
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%s: expected *SyntaxError, got=%T (%v)", engine, err, err)
+		}
+
+		_, err = interp.Run(context.Background(), "1 + true")
+		var runtimeErr *object.Error
+		if !errors.As(err, &runtimeErr) {
+			t.Fatalf("%s: expected *object.Error, got=%T (%v)", engine, err, err)
+		}
+		if runtimeErr.Error() != "1:1: type mismatch: INTEGER + BOOLEAN" {
+			t.Errorf("%s: wrong error message. got=%q", engine, runtimeErr.Error())
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := interp.Run(ctx, "1"); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got=%v", engine, err)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	for _, engine := range engines {
+		interp := newTestInterpreter(t, engine, &bytes.Buffer{})
+
+		_, err := interp.Run(context.Background(), `
+let offset = 10;
+let add = fn(a, b) { a + b + offset };
+let fail = fn() { 1 + true };
+`)
+		if err != nil {
+			t.Fatalf("%s: Run returned error: %s", engine, err)
+		}
+
+		result, err := interp.Call("add", &object.Integer{Value: 1}, &object.Integer{Value: 2})
+		if err != nil {
+			t.Fatalf("%s: Call returned error: %s", engine, err)
+		}
+		if result.Inspect() != "13" {
+			t.Errorf("%s: wrong result. want=13, got=%s", engine, result.Inspect())
+		}
+
+		result, err = interp.Call("len", &object.String{Value: "four"})
+		if err != nil {
+			t.Fatalf("%s: Call returned error: %s", engine, err)
+		}
+		if result.Inspect() != "4" {
+			t.Errorf("%s: wrong result. want=4, got=%s", engine, result.Inspect())
+		}
+
+		if _, err := interp.Call("add"); err == nil ||
+			err.Error() != "wrong number of arguments. got=0, want=2" {
+			t.Errorf("%s: wrong error for bad call. got=%v", engine, err)
+		}
+
+		if _, err := interp.Call("fail"); err == nil ||
+			err.Error() != "4:19: type mismatch: INTEGER + BOOLEAN" {
+			t.Errorf("%s: wrong error for failing call. got=%v", engine, err)
+		}
+
+		if _, err := interp.Call("missing"); err == nil {
+			t.Errorf("%s: expected error for undefined function", engine)
+		}
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	for _, engine := range engines {
+		first := newTestInterpreter(t, engine, &bytes.Buffer{})
+		second := newTestInterpreter(t, engine, &bytes.Buffer{})
+
+		first.RegisterBuiltin("double", func(args ...object.Object) object.Object {
+			n := args[0].(*object.Integer)
+			return &object.Integer{Value: n.Value * 2}
+		})
+
+		result, err := first.Run(context.Background(), "double(21)")
+		if err != nil {
+			t.Fatalf("%s: Run returned error: %s", engine, err)
+		}
+		if result.Inspect() != "42" {
+			t.Errorf("%s: wrong result. want=42, got=%s", engine, result.Inspect())
+		}
+
+		_, err = second.Run(context.Background(), "double(21)")
+		if err == nil || err.Error() != "1:1: identifier not found: double" {
+			t.Errorf("%s: builtin leaked into another interpreter. got=%v", engine, err)
+		}
+	}
+}
+
+func TestRegisterHigherOrderBuiltin(t *testing.T) {
+	for _, engine := range engines {
+		interp := newTestInterpreter(t, engine, &bytes.Buffer{})
+
+		interp.RegisterHigherOrderBuiltin("twice", func(call object.Caller, args ...object.Object) object.Object {
+			result := call(args[0], args[1])
+			if _, ok := result.(*object.Error); ok {
+				return result
+			}
+			return call(args[0], result)
+		})
+
+		result, err := interp.Run(context.Background(), `
+let offset = 1;
+twice(fn(x) { x * 2 + offset }, 5)`)
+		if err != nil {
+			t.Fatalf("%s: Run returned error: %s", engine, err)
+		}
+		if result.Inspect() != "23" {
+			t.Errorf("%s: wrong result. want=23, got=%s", engine, result.Inspect())
+		}
+
+		result, err = interp.Run(context.Background(), `twice(fn(s) { twice(len, s) }, "four")`)
+		if err == nil || err.Error() != "1:15: argument to `len` not supported, got INTEGER" {
+			t.Errorf("%s: wrong error for failing callback. got=%v, %v", engine, result, err)
+		}
+
+		result, err = interp.Call("twice", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			return &object.Integer{Value: args[0].(*object.Integer).Value + 10}
+		}}, &object.Integer{Value: 1})
+		if err != nil || result.Inspect() != "21" {
+			t.Errorf("%s: wrong result of Call. got=%v, %v", engine, result, err)
+		}
+	}
+}
+
+func TestInstancesAreIndependent(t *testing.T) {
+	for _, engine := range engines {
+		var firstOut, secondOut bytes.Buffer
+		first := newTestInterpreter(t, engine, &firstOut)
+		second := newTestInterpreter(t, engine, &secondOut)
+
+		first.Run(context.Background(), `let name = "first"; puts(name)`)
+		second.Run(context.Background(), `let name = "second"; puts(name)`)
+		first.Run(context.Background(), `puts(name)`)
+
+		if firstOut.String() != "first\nfirst\n" {
+			t.Errorf("%s: wrong output of first. got=%q", engine, firstOut.String())
+		}
+		if secondOut.String() != "second\n" {
+			t.Errorf("%s: wrong output of second. got=%q", engine, secondOut.String())
+		}
+	}
+}
+
+func TestUnknownEngine(t *testing.T) {
+	if _, err := New(Options{Engine: "jit"}); err == nil {
+		t.Fatal("expected error for unknown engine")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	for _, engine := range engines {
+		interp, err := New(Options{Engine: engine, Limits: evaluator.Limits{MaxSteps: 1000}})
+		if err != nil {
+			t.Fatalf("New returned error: %s", err)
+		}
+
+		_, err = interp.Run(context.Background(), `
+let count = fn(n) { if (n > 0) { count(n - 1) } else { 0 } };
+count(10000)`)
+		var limitErr *object.Error
+		if !errors.As(err, &limitErr) || limitErr.Kind != object.LimitError {
+			t.Fatalf("%s: expected limit error, got=%v", engine, err)
+		}
+
+		result, err := interp.Run(context.Background(), "count(10)")
+		if err != nil || result.Inspect() != "0" {
+			t.Errorf("%s: limits not reset between runs. got=%v, %v", engine, result, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		unlimited, _ := New(Options{Engine: engine})
+		_, err = unlimited.Run(ctx, `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(35)`)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected context.DeadlineExceeded, got=%v", engine, err)
+		}
+	}
+}
@@ -1,42 +1,151 @@
 package lexer
 
 import (
+	"fmt"
 	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
+	filename     string
 	input        string
 	position     int
 	readPosition int
-	char         byte
+	char         rune
+
+	// line and column of char, which counts runes
+	line   int
+	column int
+
+	errors []Error
+
+	// number of unclosed braces in each interpolated expression being read
+	interpolations []int
+}
+
+// Error is a problem with the source code found by the lexer, such as an
+// unterminated string. The lexer returns an ILLEGAL token for literals it
+// can't read at all.
+type Error struct {
+	Message string
+	Span    token.Span
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%s: %s", e.Span.Start, e.Message)
 }
 
 func New(input string) *Lexer {
-	lex := &Lexer{input: input}
+	return NewWithFilename("", input)
+}
+
+// NewWithFilename returns a lexer whose token positions refer to filename.
+func NewWithFilename(filename string, input string) *Lexer {
+	lex := &Lexer{filename: filename, input: input, line: 1}
+	lex.skipShebang()
 	return lex
 }
 
+// Errors returns the errors found so far.
+func (lex *Lexer) Errors() []Error {
+	return lex.errors
+}
+
+// error records an error about the source code from start up to and
+// including the current char.
+func (lex *Lexer) error(start token.Position, format string, a ...interface{}) {
+	lex.errors = append(lex.errors, Error{
+		Message: fmt.Sprintf(format, a...),
+		Span:    token.Span{Start: start, End: lex.endPosition()},
+	})
+}
+
+// skipShebang skips a "#!" line at the start of the input, so that scripts
+// can be made executable.
+func (lex *Lexer) skipShebang() {
+	if !strings.HasPrefix(lex.input, "#!") {
+		return
+	}
+	end := strings.IndexByte(lex.input, '\n')
+	if end < 0 {
+		end = len(lex.input)
+	}
+	lex.readPosition = end
+}
+
 func (lex *Lexer) readChar() {
+	if lex.char == '\n' {
+		lex.line += 1
+		lex.column = 0
+	}
 	if lex.readPosition >= len(lex.input) {
+		if lex.position < len(lex.input) || lex.column == 0 {
+			lex.column += 1
+		}
 		lex.char = 0
+		lex.position = len(lex.input)
 		return
 	}
-	lex.char = lex.input[lex.readPosition]
+	char, size := utf8.DecodeRuneInString(lex.input[lex.readPosition:])
+	lex.char = char
 	lex.position = lex.readPosition
-	lex.readPosition += 1
+	lex.readPosition += size
+	lex.column += 1
 }
 
-func (lex *Lexer) peekChar() byte {
-	if lex.readPosition >= len(lex.input) {
+// currentPosition returns the position of the current char.
+func (lex *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: lex.filename,
+		Offset:   lex.position,
+		Line:     lex.line,
+		Column:   lex.column,
+	}
+}
+
+// endPosition returns the position right after the current char.
+func (lex *Lexer) endPosition() token.Position {
+	pos := lex.currentPosition()
+	if lex.char != 0 {
+		pos.Offset = lex.readPosition
+		pos.Column += 1
+	}
+	return pos
+}
+
+func (lex *Lexer) peekChar() rune {
+	return lex.peekCharAt(0)
+}
+
+// peekCharAt returns the char n chars after the next one.
+func (lex *Lexer) peekCharAt(n int) rune {
+	offset := lex.readPosition
+	for ; n > 0 && offset < len(lex.input); n-- {
+		_, size := utf8.DecodeRuneInString(lex.input[offset:])
+		offset += size
+	}
+	if offset >= len(lex.input) {
 		return 0
 	}
-	return lex.input[lex.readPosition]
+	char, _ := utf8.DecodeRuneInString(lex.input[offset:])
+	return char
 }
 
 func (lex *Lexer) NextToken() token.Token {
 	lex.readChar()
-	lex.skipWhitespace()
+	comments := lex.skipTrivia()
+
+	start := lex.currentPosition()
+	tok := lex.readToken()
+	tok.Span = token.Span{Start: start, End: lex.endPosition()}
+	tok.Comments = comments
+	return tok
+}
 
+func (lex *Lexer) readToken() token.Token {
 	var newTokenWithChar = func(tok token.TokenType) token.Token {
 		return newToken(tok, lex.char)
 	}
@@ -44,34 +153,75 @@ func (lex *Lexer) NextToken() token.Token {
 	switch lex.char {
 	case '=':
 		if lex.peekChar() == '=' {
-			char := lex.char
-			lex.readChar()
-			literal := string(char) + string(lex.char)
-			return token.Token{Type: token.EQ, Literal: literal}
+			return lex.twoCharToken(token.EQ)
 		}
 		return newTokenWithChar(token.ASSIGN)
 	case '+':
+		if lex.peekChar() == '=' {
+			return lex.twoCharToken(token.PLUS_ASSIGN)
+		}
 		return newTokenWithChar(token.PLUS)
 	case '-':
+		if lex.peekChar() == '=' {
+			return lex.twoCharToken(token.MINUS_ASSIGN)
+		}
 		return newTokenWithChar(token.MINUS)
 	case '!':
 		if lex.peekChar() == '=' {
-			char := lex.char
-			lex.readChar()
-			literal := string(char) + string(lex.char)
-			return token.Token{Type: token.NOT_EQ, Literal: literal}
+			return lex.twoCharToken(token.NOT_EQ)
 		}
 		return newTokenWithChar(token.BANG)
 	case '*':
+		if lex.peekChar() == '=' {
+			return lex.twoCharToken(token.ASTERISK_ASSIGN)
+		}
 		return newTokenWithChar(token.ASTERISK)
 	case '/':
+		if lex.peekChar() == '=' {
+			return lex.twoCharToken(token.SLASH_ASSIGN)
+		}
+		if lex.peekChar() == '*' {
+			// skipTrivia leaves only unterminated comments.
+			start := lex.currentPosition()
+			literal := lex.readRest()
+			lex.error(start, "unterminated comment")
+			return token.Token{Type: token.ILLEGAL, Literal: literal}
+		}
 		return newTokenWithChar(token.SLASH)
+	case '%':
+		return newTokenWithChar(token.PERCENT)
 	case ',':
 		return newTokenWithChar(token.COMMA)
 	case '<':
+		if lex.peekChar() == '=' {
+			return lex.twoCharToken(token.LT_EQ)
+		}
+		if lex.peekChar() == '<' {
+			return lex.twoCharToken(token.SHIFT_LEFT)
+		}
 		return newTokenWithChar(token.LT)
 	case '>':
+		if lex.peekChar() == '=' {
+			return lex.twoCharToken(token.GT_EQ)
+		}
+		if lex.peekChar() == '>' {
+			return lex.twoCharToken(token.SHIFT_RIGHT)
+		}
 		return newTokenWithChar(token.GT)
+	case '&':
+		if lex.peekChar() == '&' {
+			return lex.twoCharToken(token.AND)
+		}
+		return newTokenWithChar(token.AMPERSAND)
+	case '|':
+		if lex.peekChar() == '|' {
+			return lex.twoCharToken(token.OR)
+		}
+		return newTokenWithChar(token.PIPE)
+	case '^':
+		return newTokenWithChar(token.CARET)
+	case '~':
+		return newTokenWithChar(token.TILDE)
 	case ';':
 		return newTokenWithChar(token.SEMICOLON)
 	case '(':
@@ -79,17 +229,33 @@ func (lex *Lexer) NextToken() token.Token {
 	case ')':
 		return newTokenWithChar(token.RPAREN)
 	case '{':
+		if n := len(lex.interpolations); n > 0 {
+			lex.interpolations[n-1]++
+		}
 		return newTokenWithChar(token.LBRACE)
 	case '}':
+		if n := len(lex.interpolations); n > 0 {
+			if lex.interpolations[n-1] == 0 {
+				lex.interpolations = lex.interpolations[:n-1]
+				return lex.readString()
+			}
+			lex.interpolations[n-1]--
+		}
 		return newTokenWithChar(token.RBRACE)
 	case '[':
 		return newTokenWithChar(token.LBRACKET)
 	case ']':
 		return newTokenWithChar(token.RBRACKET)
-	case '"':
-		return token.Token{Type: token.STRING, Literal: lex.readString()}
+	case '"', '`':
+		return lex.readString()
 	case ':':
 		return newTokenWithChar(token.COLON)
+	case '.':
+		if isNumber(lex.peekChar()) {
+			tokenType, number := lex.readNumber()
+			return token.Token{Type: tokenType, Literal: number}
+		}
+		return newTokenWithChar(token.ILLEGAL)
 	case 0:
 		return token.Token{Type: token.EOF, Literal: ""}
 	}
@@ -103,9 +269,9 @@ func (lex *Lexer) NextToken() token.Token {
 	}
 
 	if isNumber(lex.char) {
-		number := lex.readNumber()
+		tokenType, number := lex.readNumber()
 		return token.Token{
-			Type:    token.INT,
+			Type:    tokenType,
 			Literal: number,
 		}
 	}
@@ -113,7 +279,15 @@ func (lex *Lexer) NextToken() token.Token {
 	return newTokenWithChar(token.ILLEGAL)
 }
 
-func isWhitespace(char byte) bool {
+// twoCharToken reads the character after the current one and returns both
+// as a token of type tokenType.
+func (lex *Lexer) twoCharToken(tokenType token.TokenType) token.Token {
+	char := lex.char
+	lex.readChar()
+	return token.Token{Type: tokenType, Literal: string(char) + string(lex.char)}
+}
+
+func isWhitespace(char rune) bool {
 	return char == ' ' || char == '\t' || char == '\n' || char == '\r'
 }
 
@@ -123,14 +297,110 @@ func (lex *Lexer) skipWhitespace() {
 	}
 }
 
-func (lex *Lexer) readNumber() string {
+// skipTrivia skips whitespace and comments and returns the comments. It
+// stops in front of a block comment that is not terminated.
+func (lex *Lexer) skipTrivia() []token.Comment {
+	var comments []token.Comment
+	for {
+		lex.skipWhitespace()
+		if lex.char != '/' {
+			return comments
+		}
+
+		start := lex.currentPosition()
+		switch {
+		case lex.peekChar() == '/':
+			for lex.peekChar() != '\n' && lex.peekChar() != 0 {
+				lex.readChar()
+			}
+		case lex.peekChar() == '*' && strings.Contains(lex.input[lex.readPosition+1:], "*/"):
+			lex.readChar()
+			lex.readChar()
+			for lex.char != '*' || lex.peekChar() != '/' {
+				lex.readChar()
+			}
+			lex.readChar()
+		default:
+			return comments
+		}
+
+		comments = append(comments, token.Comment{
+			Text: lex.input[start.Offset:lex.readPosition],
+			Span: token.Span{Start: start, End: lex.endPosition()},
+		})
+		lex.readChar()
+	}
+}
+
+// readRest reads the rest of the input.
+func (lex *Lexer) readRest() string {
 	start := lex.position
-	for isNumber(lex.peekChar()) {
+	for lex.peekChar() != 0 {
 		lex.readChar()
 	}
 	return lex.input[start:lex.readPosition]
 }
 
+// readNumber reads an integer or a float such as 1.5, .5 or 1e9. The
+// current char is either a digit or a '.' followed by a digit. Integers may
+// have a 0x, 0o or 0b prefix, digits may be separated by underscores and an
+// n suffix makes a big integer. The parser reports malformed numbers.
+func (lex *Lexer) readNumber() (token.TokenType, string) {
+	start := lex.position
+	tokenType := token.TokenType(token.INT)
+
+	if lex.char == '0' && strings.ContainsRune("xXoObB", lex.peekChar()) {
+		lex.readChar()
+		for isLetter(lex.peekChar()) || isNumber(lex.peekChar()) {
+			lex.readChar()
+		}
+		literal := lex.input[start:lex.readPosition]
+		if strings.HasSuffix(literal, "n") {
+			tokenType = token.BIGINT
+		}
+		return tokenType, literal
+	}
+
+	if lex.char == '.' {
+		tokenType = token.FLOAT
+	}
+	lex.readDigits()
+
+	if tokenType == token.INT && lex.peekChar() == '.' && isNumber(lex.peekCharAt(1)) {
+		tokenType = token.FLOAT
+		lex.readChar()
+		lex.readDigits()
+	}
+
+	if lex.peekChar() == 'e' || lex.peekChar() == 'E' {
+		exponent := 1
+		if sign := lex.peekCharAt(1); sign == '+' || sign == '-' {
+			exponent = 2
+		}
+		if isNumber(lex.peekCharAt(exponent)) {
+			tokenType = token.FLOAT
+			for i := 0; i < exponent; i++ {
+				lex.readChar()
+			}
+			lex.readDigits()
+		}
+	}
+
+	if tokenType == token.INT && lex.peekChar() == 'n' {
+		tokenType = token.BIGINT
+		lex.readChar()
+	}
+
+	return tokenType, lex.input[start:lex.readPosition]
+}
+
+// readDigits reads the digits and separators that follow the current char.
+func (lex *Lexer) readDigits() {
+	for isNumber(lex.peekChar()) || lex.peekChar() == '_' {
+		lex.readChar()
+	}
+}
+
 func (lex *Lexer) readIdentifier() string {
 	start := lex.position
 	for isLetter(lex.peekChar()) {
@@ -139,23 +409,128 @@ func (lex *Lexer) readIdentifier() string {
 	return lex.input[start:lex.readPosition]
 }
 
-func (lex *Lexer) readString() string {
-	start := lex.readPosition
+// readString reads a string literal. The current char is its opening
+// quote, either '"' or '`', or the '}' that ends an interpolated expression.
+// Raw strings, which are quoted with '`', are taken verbatim; escape
+// sequences and interpolation only work in the other strings.
+func (lex *Lexer) readString() token.Token {
+	start := lex.currentPosition()
+	quote := lex.char
+	if quote == '}' {
+		quote = '"'
+	}
+
+	var value strings.Builder
+	for {
+		lex.readChar()
+		switch {
+		case lex.char == 0:
+			lex.error(start, "unterminated string")
+			return token.Token{Type: token.ILLEGAL, Literal: lex.input[start.Offset:lex.position]}
+		case lex.char == quote:
+			return token.Token{Type: token.STRING, Literal: value.String()}
+		case quote == '"' && lex.char == '$' && lex.peekChar() == '{':
+			if lex.skipEmptyInterpolation() {
+				continue
+			}
+			lex.readChar()
+			lex.interpolations = append(lex.interpolations, 0)
+			return token.Token{Type: token.INTERPOLATION, Literal: value.String()}
+		case quote == '"' && lex.char == '\\':
+			lex.readEscape(&value)
+		default:
+			// Copied from the input so that invalid UTF-8 is kept as is.
+			value.WriteString(lex.input[lex.position:lex.readPosition])
+		}
+	}
+}
+
+// skipEmptyInterpolation reports and skips a "${}" that starts with the
+// current char and has only white space between the braces. The string
+// goes on after it.
+func (lex *Lexer) skipEmptyInterpolation() bool {
+	n := 1
+	for isWhitespace(lex.peekCharAt(n)) {
+		n++
+	}
+	if lex.peekCharAt(n) != '}' {
+		return false
+	}
+
+	start := lex.currentPosition()
+	for ; n >= 0; n-- {
+		lex.readChar()
+	}
+	lex.error(start, "empty interpolation")
+	return true
+}
+
+// readEscape reads the escape sequence that starts with the current char,
+// a backslash, and writes its value to out.
+func (lex *Lexer) readEscape(out *strings.Builder) {
+	start := lex.currentPosition()
+	if lex.peekChar() == 0 {
+		return
+	}
+
+	lex.readChar()
+	switch lex.char {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '\\', '"', '$':
+		out.WriteRune(lex.char)
+	case 'u':
+		lex.readUnicodeEscape(start, out)
+	default:
+		lex.error(start, "invalid escape sequence \\%c", lex.char)
+	}
+}
+
+// readUnicodeEscape reads the "{...}" of a "\u{...}" escape sequence, which
+// holds the hexadecimal code point of a character.
+func (lex *Lexer) readUnicodeEscape(start token.Position, out *strings.Builder) {
+	if lex.peekChar() != '{' {
+		lex.error(start, "invalid escape sequence \\u, want \\u{...}")
+		return
+	}
 	lex.readChar()
-	for lex.char != '"' && lex.char != 0 {
+
+	digits := lex.readPosition
+	for isHexDigit(lex.peekChar()) {
 		lex.readChar()
 	}
-	return lex.input[start:lex.position]
+	hex := lex.input[digits:lex.readPosition]
+
+	if lex.peekChar() != '}' {
+		lex.error(start, "unterminated unicode escape")
+		return
+	}
+	lex.readChar()
+
+	code, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		lex.error(start, "invalid unicode code point %q", hex)
+		return
+	}
+	out.WriteRune(rune(code))
 }
 
-func isNumber(char byte) bool {
+func isNumber(char rune) bool {
 	return '0' <= char && char <= '9'
 }
 
-func isLetter(char byte) bool {
-	return 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || char == '_'
+func isHexDigit(char rune) bool {
+	return isNumber(char) || 'a' <= char && char <= 'f' || 'A' <= char && char <= 'F'
+}
+
+func isLetter(char rune) bool {
+	return unicode.IsLetter(char) || char == '_'
 }
 
-func newToken(tokenType token.TokenType, char byte) token.Token {
+func newToken(tokenType token.TokenType, char rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(char)}
 }
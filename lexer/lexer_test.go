@@ -15,7 +15,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -30,6 +30,10 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+while for in break continue
+x += 1 -= 2 *= 3 /= 4;
+a <= b >= c && d || e;
+a % b & c | d ^ ~e << 1 >> 2;
 `
 
 	tests := []struct {
@@ -122,6 +126,426 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.AND, "&&"},
+		{token.IDENT, "d"},
+		{token.OR, "||"},
+		{token.IDENT, "e"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "b"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "c"},
+		{token.PIPE, "|"},
+		{token.IDENT, "d"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.IDENT, "e"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.INT, "1"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := "5 1.5 .5 10.25 1e9 1E+9 2.5e-3 1. 1.foo 1e 1ex " +
+		"0xFF 0o755 0B1010 1_000_000 1_000.5 0x 0b102 0x1e+1 " +
+		"10n 1_000n 0xFFn 1.5n"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "1.5"},
+		{token.FLOAT, ".5"},
+		{token.FLOAT, "10.25"},
+		{token.FLOAT, "1e9"},
+		{token.FLOAT, "1E+9"},
+		{token.FLOAT, "2.5e-3"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "foo"},
+		{token.INT, "1"},
+		{token.IDENT, "e"},
+		{token.INT, "1"},
+		{token.IDENT, "ex"},
+		{token.INT, "0xFF"},
+		{token.INT, "0o755"},
+		{token.INT, "0B1010"},
+		{token.INT, "1_000_000"},
+		{token.FLOAT, "1_000.5"},
+		{token.INT, "0x"},
+		{token.INT, "0b102"},
+		{token.INT, "0x1e"},
+		{token.PLUS, "+"},
+		{token.INT, "1"},
+		{token.BIGINT, "10n"},
+		{token.BIGINT, "1_000n"},
+		{token.BIGINT, "0xFFn"},
+		{token.FLOAT, "1.5"},
+		{token.IDENT, "n"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + 10\n\"foo\""
+
+	tests := []struct {
+		expectedType      token.TokenType
+		expectedLine      int
+		expectedColumn    int
+		expectedOffset    int
+		expectedEndOffset int
+	}{
+		{token.LET, 1, 1, 0, 3},
+		{token.IDENT, 1, 5, 4, 5},
+		{token.ASSIGN, 1, 7, 6, 7},
+		{token.INT, 1, 9, 8, 9},
+		{token.SEMICOLON, 1, 10, 9, 10},
+		{token.IDENT, 2, 3, 13, 14},
+		{token.PLUS, 2, 5, 15, 16},
+		{token.INT, 2, 7, 17, 19},
+		{token.STRING, 3, 1, 20, 25},
+		{token.EOF, 3, 6, 25, 25},
+	}
+
+	l := NewWithFilename("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		start := tok.Span.Start
+		if start.Filename != "test.mk" {
+			t.Fatalf("tests[%d] - filename wrong. got=%q", i, start.Filename)
+		}
+
+		if start.Line != tt.expectedLine || start.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, start.Line, start.Column)
+		}
+
+		if start.Offset != tt.expectedOffset || tok.Span.End.Offset != tt.expectedEndOffset {
+			t.Fatalf("tests[%d] - offsets wrong. expected=[%d, %d), got=[%d, %d)",
+				i, tt.expectedOffset, tt.expectedEndOffset,
+				start.Offset, tok.Span.End.Offset)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let größe = \"日本\";\nπ + größe €"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+		expectedOffset  int
+	}{
+		{token.LET, "let", 1, 1, 0},
+		{token.IDENT, "größe", 1, 5, 4},
+		{token.ASSIGN, "=", 1, 11, 12},
+		{token.STRING, "日本", 1, 13, 14},
+		{token.SEMICOLON, ";", 1, 17, 22},
+		{token.IDENT, "π", 2, 1, 24},
+		{token.PLUS, "+", 2, 3, 27},
+		{token.IDENT, "größe", 2, 5, 29},
+		{token.ILLEGAL, "€", 2, 11, 37},
+		{token.EOF, "", 2, 12, 40},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		start := tok.Span.Start
+		if start.Line != tt.expectedLine || start.Column != tt.expectedColumn ||
+			start.Offset != tt.expectedOffset {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d (offset %d), got=%d:%d (offset %d)",
+				i, tt.expectedLine, tt.expectedColumn, tt.expectedOffset,
+				start.Line, start.Column, start.Offset)
+		}
+	}
+}
+
+func TestShebangLine(t *testing.T) {
+	input := "#!/usr/bin/env monkey\nlet x = 1;"
+
+	l := New(input)
+	tok := l.NextToken()
+
+	if tok.Type != token.LET {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.LET, tok.Type)
+	}
+
+	if tok.Span.Start.Line != 2 || tok.Span.Start.Column != 1 {
+		t.Fatalf("position wrong. expected=2:1, got=%s", tok.Span.Start)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// add two numbers
+let x = 1 / 2; // half
+/* a block
+   comment */ x /= 3 /**/;
+// at the end`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedComments []string
+	}{
+		{token.LET, []string{"// add two numbers"}},
+		{token.IDENT, nil},
+		{token.ASSIGN, nil},
+		{token.INT, nil},
+		{token.SLASH, nil},
+		{token.INT, nil},
+		{token.SEMICOLON, nil},
+		{token.IDENT, []string{"// half", "/* a block\n   comment */"}},
+		{token.SLASH_ASSIGN, nil},
+		{token.INT, nil},
+		{token.SEMICOLON, []string{"/**/"}},
+		{token.EOF, []string{"// at the end"}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if len(tok.Comments) != len(tt.expectedComments) {
+			t.Fatalf("tests[%d] - wrong number of comments. expected=%d, got=%d",
+				i, len(tt.expectedComments), len(tok.Comments))
+		}
+		for j, comment := range tok.Comments {
+			if comment.Text != tt.expectedComments[j] {
+				t.Errorf("tests[%d] - comment %d wrong. expected=%q, got=%q",
+					i, j, tt.expectedComments[j], comment.Text)
+			}
+		}
+	}
+}
+
+func TestCommentPositions(t *testing.T) {
+	input := "x // one\n  /* two\n */ y"
+
+	l := New(input)
+	l.NextToken()
+	tok := l.NextToken()
+
+	tests := []struct {
+		expectedStart string
+		expectedEnd   string
+	}{
+		{"1:3", "1:9"},
+		{"2:3", "3:4"},
+	}
+
+	if len(tok.Comments) != len(tests) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(tests), len(tok.Comments))
+	}
+	for i, tt := range tests {
+		span := tok.Comments[i].Span
+		if span.Start.String() != tt.expectedStart || span.End.String() != tt.expectedEnd {
+			t.Errorf("tests[%d] - span wrong. expected=%s-%s, got=%s-%s",
+				i, tt.expectedStart, tt.expectedEnd, span.Start, span.End)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("x /* never closed")
+
+	l.NextToken()
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "/* never closed" {
+		t.Fatalf("wrong token. expected=ILLEGAL %q, got=%s %q",
+			"/* never closed", tok.Type, tok.Literal)
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("expected EOF, got=%s", tok.Type)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	input := "\"a\\nb\\tc\" \"say \\\"hi\\\"\" \"back\\\\slash\" \"\\u{48}\\u{1F600}\" `raw \\n \"line\"\nnext`"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "a\nb\tc"},
+		{token.STRING, `say "hi"`},
+		{token.STRING, `back\slash`},
+		{token.STRING, "H\U0001F600"},
+		{token.STRING, "raw \\n \"line\"\nnext"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedType   token.TokenType
+		expectedErrors []string
+	}{
+		{`"abc`, token.ILLEGAL, []string{"1:1: unterminated string"}},
+		{"`abc", token.ILLEGAL, []string{"1:1: unterminated string"}},
+		{`"abc\`, token.ILLEGAL, []string{"1:1: unterminated string"}},
+		{`"a\qb"`, token.STRING, []string{`1:3: invalid escape sequence \q`}},
+		{`"\u41"`, token.STRING, []string{`1:2: invalid escape sequence \u, want \u{...}`}},
+		{`"\u{41"`, token.STRING, []string{"1:2: unterminated unicode escape"}},
+		{`"\u{D800}"`, token.STRING, []string{`1:2: invalid unicode code point "D800"`}},
+		{`"\u{}"`, token.STRING, []string{`1:2: invalid unicode code point ""`}},
+		{"/* abc", token.ILLEGAL, []string{"1:1: unterminated comment"}},
+		{`"a${}b${ }"`, token.STRING, []string{
+			"1:3: empty interpolation",
+			"1:7: empty interpolation",
+		}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Errorf("%q: tokentype wrong. expected=%q, got=%q",
+				tt.input, tt.expectedType, tok.Type)
+		}
+
+		errors := l.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("%q: wrong number of errors. expected=%d, got=%v",
+				tt.input, len(tt.expectedErrors), errors)
+			continue
+		}
+		for i, err := range errors {
+			if err.String() != tt.expectedErrors[i] {
+				t.Errorf("%q: error %d wrong. expected=%q, got=%q",
+					tt.input, i, tt.expectedErrors[i], err.String())
+			}
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	input := "\"Hi ${name}, ${ {\"a\": \"${x}\"}[\"a\"] }!\" \"\\${no}\" `${raw}`"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERPOLATION, "Hi "},
+		{token.IDENT, "name"},
+		{token.INTERPOLATION, ", "},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.INTERPOLATION, ""},
+		{token.IDENT, "x"},
+		{token.STRING, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "a"},
+		{token.RBRACKET, "]"},
+		{token.STRING, "!"},
+		{token.STRING, "${no}"},
+		{token.STRING, "${raw}"},
 		{token.EOF, ""},
 	}
 
@@ -1,19 +1,158 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/interpreter"
+	"monkey/object"
 	"monkey/repl"
 	"os"
 	"os/user"
 )
 
+// Exit codes of the monkey command.
+const (
+	exitOK           = 0
+	exitRuntimeError = 1
+	exitSyntaxError  = 2 // also used for usage errors
+)
+
+const usage = `usage:
+  monkey [flags]                      start the REPL, or run the program piped to stdin
+  monkey [flags] [run] file [args...] run a script, '-' reads it from stdin
+  monkey [flags] -e expr [args...]    evaluate expr and print its value
+
+flags:
+`
+
 func main() {
-	user, err := user.Current()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(arguments []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkey", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	engine := flags.String("engine", interpreter.EngineEval, "use 'eval' or 'vm'")
+	expression := flags.String("e", "", "evaluate `expr` and print its value")
+	overflow := flags.String("overflow", string(evaluator.OverflowWrap),
+		"on integer overflow 'wrap', return an 'error' or 'promote' to a big integer")
+
+	if err := flags.Parse(arguments); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitSyntaxError
+	}
+
+	var filename, src string
+	args := flags.Args()
+	interactive, fromStdin := false, false
+
+	switch {
+	case *expression != "":
+		filename, src = "-e", *expression
+
+	case len(args) > 0:
+		if args[0] == "run" {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			flags.Usage()
+			return exitSyntaxError
+		}
+
+		filename, args = args[0], args[1:]
+		if filename == "-" {
+			fromStdin = true
+			break
+		}
+
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitRuntimeError
+		}
+		src = string(b)
+
+	case isTerminal(stdin):
+		interactive = true
+
+	default:
+		fromStdin = true
+	}
+
+	if fromStdin {
+		filename = "<stdin>"
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitRuntimeError
+		}
+		src = string(b)
+	}
+
+	interp, err := interpreter.New(interpreter.Options{
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Engine:   *engine,
+		Overflow: evaluator.Overflow(*overflow),
+		Args:     args,
+	})
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(stderr, err)
+		return exitSyntaxError
+	}
+
+	if interactive {
+		greet(stdout)
+		repl.Start(stdin, stdout, interp)
+		return exitOK
 	}
+	return runScript(interp, filename, src, *expression != "")
+}
+
+func isTerminal(r io.Reader) bool {
+	file, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
-	fmt.Println("Feel free to type in commands")
-	repl.Start(os.Stdin, os.Stdout)
+func greet(out io.Writer) {
+	name := "there"
+	if user, err := user.Current(); err == nil {
+		name = user.Username
+	}
+
+	fmt.Fprintf(out, "Hello %s! This is the Monkey programming language!\n", name)
+	fmt.Fprintln(out, "Feel free to type in commands")
+}
+
+func runScript(interp *interpreter.Interpreter, filename string, src string, printResult bool) int {
+	result, err := interp.RunFile(context.Background(), filename, src)
+
+	var runtimeErr *object.Error
+	switch {
+	case errors.As(err, &runtimeErr):
+		fmt.Fprint(interp.Stderr(), runtimeErr.Inspect()+"\n\n"+runtimeErr.StackTrace())
+		return exitRuntimeError
+	case err != nil:
+		fmt.Fprintln(interp.Stderr(), err)
+		return exitSyntaxError
+	}
+
+	if printResult && result != nil && result != evaluator.NULL {
+		fmt.Fprintln(interp.Stdout(), result.Inspect())
+	}
+	return exitOK
 }
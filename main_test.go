@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.mk")
+	src := "#!/usr/bin/env monkey\nputs(args());\nargs()[0] + 1\n"
+	if err := os.WriteFile(script, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args           []string
+		stdin          string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"-e", "1 + 2"}, "", exitOK, "3\n", ""},
+		{[]string{"-engine", "vm", "-e", "1 + 2"}, "", exitOK, "3\n", ""},
+		{[]string{"-e", "let x = 1;"}, "", exitOK, "", ""},
+		{[]string{"-e", "args()", "a", "b"}, "", exitOK, "[a, b]\n", ""},
+		{[]string{"-e", "let x = ;"}, "", exitSyntaxError, "", "-e:1:9: no prefix parse function for ; found"},
+		{[]string{"-e", "1 + true"}, "", exitRuntimeError, "", "ERROR: -e:1:1: type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"run", script, "x", "y"}, "", exitRuntimeError, "[x, y]\n", "script.mk:3:1: type mismatch: STRING + INTEGER"},
+		{[]string{script, "x"}, "", exitRuntimeError, "[x]\n", "script.mk:3:1: type mismatch"},
+		{[]string{"-engine", "vm", script, "x"}, "", exitRuntimeError, "[x]\n", "script.mk:3:1: type mismatch"},
+		{[]string{"run", filepath.Join(dir, "missing.mk")}, "", exitRuntimeError, "", "no such file"},
+		{[]string{"run"}, "", exitSyntaxError, "", "usage:"},
+		{[]string{"-engine", "jit"}, "", exitSyntaxError, "", `unknown engine "jit"`},
+		{[]string{"-overflow", "promote", "-e", "9223372036854775807 + 1"}, "", exitOK, "9223372036854775808\n", ""},
+		{[]string{"-overflow", "error", "-e", "9223372036854775807 + 1"}, "", exitRuntimeError, "", "integer overflow"},
+		{[]string{"-overflow", "saturate"}, "", exitSyntaxError, "", `unknown overflow policy "saturate"`},
+		{nil, "puts(1 * 2)", exitOK, "2\n", ""},
+		{[]string{"-", "z"}, "puts(args())", exitOK, "[z]\n", ""},
+		{nil, "\nfoo", exitRuntimeError, "", "ERROR: <stdin>:2:1: identifier not found: foo"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d (stderr=%q)",
+				tt.args, tt.expectedCode, code, stderr.String())
+		}
+
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("%v: wrong stdout. want=%q, got=%q",
+				tt.args, tt.expectedStdout, stdout.String())
+		}
+
+		if !strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: stderr does not contain %q. got=%q",
+				tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
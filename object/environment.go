@@ -28,3 +28,16 @@ func (env *Environment) Set(name string, value Object) Object {
 	env.store[name] = value
 	return value
 }
+
+// Assign changes the value of name in the innermost environment that
+// defines it. It returns false if none does.
+func (env *Environment) Assign(name string, value Object) bool {
+	if _, ok := env.store[name]; ok {
+		env.store[name] = value
+		return true
+	}
+	if env.outer != nil {
+		return env.outer.Assign(name, value)
+	}
+	return false
+}
@@ -3,7 +3,10 @@ package object
 import (
 	"fmt"
 	"hash/fnv"
+	"math/big"
 	"monkey/ast"
+	"monkey/code"
+	"monkey/token"
 	"strconv"
 	"strings"
 )
@@ -12,15 +15,25 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ      ObjectType = "INTEGER"
+	BIGINT_OBJ       ObjectType = "BIGINT"
+	FLOAT_OBJ        ObjectType = "FLOAT"
 	BOOLEAN_OBJ      ObjectType = "BOOLEAN"
 	NULL_OBJ         ObjectType = "NULL"
 	RETURN_VALUE_OBJ ObjectType = "RETURN_VALUE"
+	BREAK_OBJ        ObjectType = "BREAK"
+	CONTINUE_OBJ     ObjectType = "CONTINUE"
 	ERROR_OBJ        ObjectType = "ERROR"
 	FUNCTION_OBJ     ObjectType = "FUNCTION"
 	STRING_OBJ       ObjectType = "STRING"
 	BUILTIN_OBJ      ObjectType = "BUILTIN"
 	ARRAY_OBJ        ObjectType = "ARRAY"
 	HASH_OBJ         ObjectType = "HASH"
+	QUOTE_OBJ        ObjectType = "QUOTE"
+	MACRO_OBJ        ObjectType = "MACRO"
+
+	COMPILED_FUNCTION_OBJ ObjectType = "COMPILED_FUNCTION"
+	ITERATOR_OBJ          ObjectType = "ITERATOR"
+	CELL_OBJ              ObjectType = "CELL"
 )
 
 type Object interface {
@@ -37,6 +50,14 @@ type Hasher interface {
 	HashKey() HashKey
 }
 
+// hashString hashes strings and big integers for their hash keys. Tests
+// replace it with a weak hash to cause collisions.
+var hashString = func(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
 type Integer struct {
 	Value int64
 }
@@ -47,6 +68,38 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: INTEGER_OBJ, Value: uint64(i.Value)}
 }
 
+// BigInt is an integer of any size.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+
+// HashKey returns the hash key of the equal Integer if there is one, so that
+// both find the same pair.
+func (b *BigInt) HashKey() HashKey {
+	if b.Value.IsInt64() {
+		return HashKey{Type: INTEGER_OBJ, Value: uint64(b.Value.Int64())}
+	}
+	return HashKey{Type: BIGINT_OBJ, Value: hashString(b.Value.String())}
+}
+
+// Floats are not hashable, as a float key that equals an integer key
+// would have to find the same pair.
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	str := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if strings.ContainsAny(str, ".eIN") {
+		return str
+	}
+	return str + ".0"
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -73,14 +126,92 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break and Continue end the evaluation of a loop body, the way
+// ReturnValue ends the evaluation of a function body.
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// ErrorKind separates errors in a program from errors that stop a program
+// because it ran out of its limits.
+type ErrorKind int
+
+const (
+	RuntimeError ErrorKind = iota
+	LimitError
+)
+
 type Error struct {
 	Message string
+	Kind    ErrorKind
+	Pos     token.Position
+	Trace   []Frame
+
+	// Cause is the error of the host that led to the error, if any, such
+	// as a done context.
+	Cause error
 }
 
 func (er *Error) Type() ObjectType { return ERROR_OBJ }
-func (er *Error) Inspect() string  { return "ERROR: " + er.Message }
+func (er *Error) Inspect() string {
+	if er.Pos.IsValid() {
+		return fmt.Sprintf("ERROR: %s: %s", er.Pos, er.Message)
+	}
+	return "ERROR: " + er.Message
+}
+
+// Error lets runtime errors be returned as Go errors.
+func (er *Error) Error() string {
+	if er.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", er.Pos, er.Message)
+	}
+	return er.Message
+}
+
+func (er *Error) Unwrap() error { return er.Cause }
+
+// Names used for stack frames that don't belong to a named function.
+const (
+	MainFunction      = "<main>"
+	AnonymousFunction = "<anonymous>"
+)
+
+// Frame is an entry of a stack trace. Pos is the position at which the
+// function was executing when the trace was taken.
+type Frame struct {
+	Function string
+	Pos      token.Position
+}
+
+// traceEdge is the number of innermost and outermost frames printed of a
+// deep trace, such as one of a runaway recursion.
+const traceEdge = 10
+
+// StackTrace formats the trace of the error, innermost call first. The
+// middle of a deep trace is elided.
+func (er *Error) StackTrace() string {
+	var out strings.Builder
+	elided := len(er.Trace) - 2*traceEdge
+	for i, frame := range er.Trace {
+		if elided > 1 && i >= traceEdge && i < len(er.Trace)-traceEdge {
+			if i == traceEdge {
+				fmt.Fprintf(&out, "... %d frames elided ...\n", elided)
+			}
+			continue
+		}
+		fmt.Fprintf(&out, "%s(...)\n\t%s\n", frame.Function, frame.Pos)
+	}
+	return out.String()
+}
 
 type Function struct {
+	Name       string
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -108,15 +239,24 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 func (s *String) HashKey() HashKey {
-	h := fnv.New64a()
-	h.Write([]byte(s.Value))
-	return HashKey{Type: STRING_OBJ, Value: h.Sum64()}
+	return HashKey{Type: STRING_OBJ, Value: hashString(s.Value)}
 }
 
 type BuiltinFunction func(args ...Object) Object
 
+// Caller calls a function or builtin with args and returns the result,
+// which may be an error.
+type Caller func(fn Object, args ...Object) Object
+
+// HigherOrderFunction is a builtin that calls functions passed to it as
+// arguments, such as map. It calls them with call.
+type HigherOrderFunction func(call Caller, args ...Object) Object
+
+// Builtin is a function implemented in Go. HigherOrderFn, if set, is called
+// instead of Fn.
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn            BuiltinFunction
+	HigherOrderFn HigherOrderFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -127,29 +267,184 @@ type Array struct {
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
-func (a *Array) Inspect() string {
-	elements := make([]string, 0, len(a.Elements))
-	for _, elem := range a.Elements {
-		elements = append(elements, elem.Inspect())
-	}
-	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
-}
+func (a *Array) Inspect() string  { return inspect(a, map[Object]bool{}) }
 
 type HashPair struct {
 	Key   Object
 	Value Object
 }
 
+// Hash maps keys, which must implement Hasher, to values. It keeps its
+// pairs in insertion order. The zero value is an empty hash.
+//
+// Distinct keys may have the same HashKey, so the pairs are found through
+// buckets of all keys with a HashKey, which are then compared.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	pairs   []HashPair
+	buckets map[HashKey][]int // positions in pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	pairs := make([]string, 0, len(h.Pairs))
-	for _, pair := range h.Pairs {
-		str := fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect())
-		pairs = append(pairs, str)
+func (h *Hash) Inspect() string  { return inspect(h, map[Object]bool{}) }
+
+// inspect formats obj like its Inspect method. Arrays and hashes can
+// contain themselves, so a container that is already being formatted,
+// which visiting holds, is printed as [...] or {...}.
+func inspect(obj Object, visiting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		if visiting[obj] {
+			return "[...]"
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		elements := make([]string, 0, len(obj.Elements))
+		for _, elem := range obj.Elements {
+			elements = append(elements, inspect(elem, visiting))
+		}
+		return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+	case *Hash:
+		if visiting[obj] {
+			return "{...}"
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		pairs := make([]string, 0, len(obj.pairs))
+		for _, pair := range obj.pairs {
+			str := fmt.Sprintf("%s: %s", inspect(pair.Key, visiting), inspect(pair.Value, visiting))
+			pairs = append(pairs, str)
+		}
+		return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+	default:
+		return obj.Inspect()
+	}
+}
+
+// Get returns the pair whose key equals key.
+func (h *Hash) Get(key Object) (HashPair, bool) {
+	for _, i := range h.buckets[key.(Hasher).HashKey()] {
+		if keysEqual(h.pairs[i].Key, key) {
+			return h.pairs[i], true
+		}
+	}
+	return HashPair{}, false
+}
+
+// Set adds a pair to the end of h or, if h already has the key, replaces
+// the value of its pair in place.
+func (h *Hash) Set(key Object, value Object) {
+	hashKey := key.(Hasher).HashKey()
+	for _, i := range h.buckets[hashKey] {
+		if keysEqual(h.pairs[i].Key, key) {
+			h.pairs[i].Value = value
+			return
+		}
+	}
+
+	if h.buckets == nil {
+		h.buckets = make(map[HashKey][]int)
 	}
-	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+	h.buckets[hashKey] = append(h.buckets[hashKey], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+}
+
+// Pairs returns the pairs of h in insertion order. The slice must not be
+// modified.
+func (h *Hash) Pairs() []HashPair { return h.pairs }
+
+func (h *Hash) Len() int { return len(h.pairs) }
+
+// keysEqual reports whether two hash keys with the same HashKey are equal.
+// An integer equals the big integer of the same value.
+func keysEqual(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == b.Value
+		case *BigInt:
+			return b.Value.IsInt64() && b.Value.Int64() == a.Value
+		}
+	case *BigInt:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value.IsInt64() && a.Value.Int64() == b.Value
+		case *BigInt:
+			return a.Value.Cmp(b.Value) == 0
+		}
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	}
+	return false
+}
+
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	params := []string{}
+	for _, identifier := range m.Parameters {
+		params = append(params, identifier.String())
+	}
+
+	return fmt.Sprintf(
+		"macro (%s) {\n%s\n}",
+		strings.Join(params, ", "),
+		m.Body.String(),
+	)
+}
+
+type CompiledFunction struct {
+	Name          string
+	Instructions  code.Instructions
+	SourceMap     code.SourceMap
+	NumLocals     int
+	NumParameters int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Cell
+}
+
+// Closures are the functions of the virtual machine, so they report the
+// same type as the functions of the evaluator.
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Cell holds a variable captured by a closure, so that assignments to it
+// are seen by both the closure and the function that defines it.
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string {
+	return fmt.Sprintf("Cell[%p]", c)
 }
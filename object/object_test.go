@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +62,98 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestBigIntHashKey(t *testing.T) {
+	huge1, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	huge2, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	other, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+
+	if (&BigInt{Value: huge1}).HashKey() != (&BigInt{Value: huge2}).HashKey() {
+		t.Errorf("big integers with same content have different hash keys")
+	}
+
+	if (&BigInt{Value: huge1}).HashKey() == (&BigInt{Value: other}).HashKey() {
+		t.Errorf("big integers with different content have same hash keys")
+	}
+
+	small := &BigInt{Value: big.NewInt(42)}
+	if small.HashKey() != (&Integer{Value: 42}).HashKey() {
+		t.Errorf("big integer and equal integer have different hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-3, "-3.0"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		float := &Float{Value: tt.value}
+		if float.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %g. want=%q, got=%q",
+				tt.value, tt.expected, float.Inspect())
+		}
+	}
+}
+
+func TestHashCollisions(t *testing.T) {
+	defer func(hash func(string) uint64) { hashString = hash }(hashString)
+	hashString = func(s string) uint64 { return uint64(len(s)) }
+
+	hash := &Hash{}
+	hash.Set(&String{Value: "ab"}, &Integer{Value: 1})
+	hash.Set(&String{Value: "cd"}, &Integer{Value: 2})
+	hash.Set(&String{Value: "ef"}, &Integer{Value: 3})
+	hash.Set(&String{Value: "cd"}, &Integer{Value: 4})
+
+	if hash.Len() != 3 {
+		t.Fatalf("colliding keys overwrote each other. got=%s", hash.Inspect())
+	}
+	if hash.Inspect() != "{ab: 1, cd: 4, ef: 3}" {
+		t.Errorf("wrong pairs. got=%s", hash.Inspect())
+	}
+
+	for key, expected := range map[string]int64{"ab": 1, "cd": 4, "ef": 3} {
+		pair, ok := hash.Get(&String{Value: key})
+		if !ok || pair.Value.(*Integer).Value != expected {
+			t.Errorf("wrong pair for %q. got=%+v (%t)", key, pair, ok)
+		}
+	}
+
+	if _, ok := hash.Get(&String{Value: "gh"}); ok {
+		t.Errorf("found pair for missing key with colliding hash")
+	}
+
+	huge1, _ := new(big.Int).SetString("10000000000000000000", 10)
+	huge2, _ := new(big.Int).SetString("20000000000000000000", 10)
+	hash.Set(&BigInt{Value: huge1}, &Integer{Value: 5})
+	hash.Set(&BigInt{Value: huge2}, &Integer{Value: 6})
+
+	pair, ok := hash.Get(&BigInt{Value: huge2})
+	if !ok || pair.Value.(*Integer).Value != 6 {
+		t.Errorf("wrong pair for colliding big integer. got=%+v (%t)", pair, ok)
+	}
+}
+
+func TestHashIntegerKeys(t *testing.T) {
+	hash := &Hash{}
+	hash.Set(&Integer{Value: 5}, &String{Value: "five"})
+	hash.Set(&BigInt{Value: big.NewInt(5)}, &String{Value: "FIVE"})
+
+	if hash.Len() != 1 {
+		t.Fatalf("equal integer and big integer are different keys. got=%s", hash.Inspect())
+	}
+
+	pair, ok := hash.Get(&BigInt{Value: big.NewInt(5)})
+	if !ok || pair.Value.Inspect() != "FIVE" {
+		t.Errorf("wrong pair. got=%+v (%t)", pair, ok)
+	}
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/token"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Code identifies the kind of a diagnostic independently of its message.
+type Code string
+
+const (
+	UnexpectedToken         Code = "unexpected-token"
+	NoPrefixParser          Code = "no-prefix-parser"
+	InvalidInteger          Code = "invalid-integer"
+	InvalidFloat            Code = "invalid-float"
+	OutsideLoop             Code = "outside-loop"
+	LoopControlInExpression Code = "loop-control-in-expression"
+	InvalidAssignment       Code = "invalid-assignment"
+	InvalidToken            Code = "invalid-token"
+)
+
+// Diagnostic describes a problem the parser found in the source code.
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	Span     token.Span
+
+	// Expected lists the token types that would have been valid at Span,
+	// Found is the token that was there instead.
+	Expected []token.TokenType
+	Found    token.Token
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Span.Start, d.Message)
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+)
+
+// checkLoopControl reports break and continue statements inside the blocks
+// of if expressions whose value is used, as in `let x = if (c) { break }`.
+// Leaving a loop there would leave the expression half evaluated. inValue
+// reports whether the value of statements is used.
+func (p *Parser) checkLoopControl(statements []ast.Statement, inValue bool) {
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.BreakStatement:
+			p.checkNotInValue(statement.Token, inValue)
+		case *ast.ContinueStatement:
+			p.checkNotInValue(statement.Token, inValue)
+		case *ast.ExpressionStatement:
+			if expression, ok := statement.Expression.(*ast.IfExpression); ok {
+				p.checkExpressionLoopControl(expression.Condition)
+				p.checkBlockLoopControl(expression.Consequence, inValue)
+				p.checkBlockLoopControl(expression.Alternative, inValue)
+			} else {
+				p.checkExpressionLoopControl(statement.Expression)
+			}
+		case *ast.LetStatement:
+			p.checkExpressionLoopControl(statement.Value)
+		case *ast.ReturnStatement:
+			p.checkExpressionLoopControl(statement.ReturnValue)
+		case *ast.WhileStatement:
+			p.checkExpressionLoopControl(statement.Condition)
+			p.checkBlockLoopControl(statement.Body, false)
+		case *ast.ForStatement:
+			p.checkExpressionLoopControl(statement.Iterable)
+			p.checkBlockLoopControl(statement.Body, false)
+		}
+	}
+}
+
+func (p *Parser) checkBlockLoopControl(block *ast.BlockStatement, inValue bool) {
+	if block != nil {
+		p.checkLoopControl(block.Statements, inValue)
+	}
+}
+
+// checkExpressionLoopControl checks an expression whose value is used.
+// Function bodies are not, and loops can't be left from them anyway.
+func (p *Parser) checkExpressionLoopControl(expression ast.Expression) {
+	switch expression := expression.(type) {
+	case *ast.IfExpression:
+		p.checkExpressionLoopControl(expression.Condition)
+		p.checkBlockLoopControl(expression.Consequence, true)
+		p.checkBlockLoopControl(expression.Alternative, true)
+	case *ast.FunctionLiteral:
+		p.checkBlockLoopControl(expression.Body, false)
+	case *ast.MacroLiteral:
+		p.checkBlockLoopControl(expression.Body, false)
+	case *ast.PrefixExpression:
+		p.checkExpressionLoopControl(expression.Right)
+	case *ast.InfixExpression:
+		p.checkExpressionLoopControl(expression.Left)
+		p.checkExpressionLoopControl(expression.Right)
+	case *ast.AssignExpression:
+		p.checkExpressionLoopControl(expression.Target)
+		p.checkExpressionLoopControl(expression.Value)
+	case *ast.CallExpression:
+		p.checkExpressionLoopControl(expression.Function)
+		for _, argument := range expression.Arguments {
+			p.checkExpressionLoopControl(argument)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range expression.Parts {
+			p.checkExpressionLoopControl(part)
+		}
+	case *ast.ArrayLiteral:
+		for _, element := range expression.Elements {
+			p.checkExpressionLoopControl(element)
+		}
+	case *ast.IndexExpression:
+		p.checkExpressionLoopControl(expression.Left)
+		p.checkExpressionLoopControl(expression.Index)
+	case *ast.HashLiteral:
+		for _, pair := range expression.Pairs {
+			p.checkExpressionLoopControl(pair.Key)
+			p.checkExpressionLoopControl(pair.Value)
+		}
+	}
+}
+
+func (p *Parser) checkNotInValue(tok token.Token, inValue bool) {
+	if !inValue {
+		return
+	}
+
+	p.report(Diagnostic{
+		Code:    LoopControlInExpression,
+		Message: fmt.Sprintf("%s inside an expression whose value is used", tok.Literal),
+		Span:    tok.Span,
+		Found:   tok,
+	})
+}
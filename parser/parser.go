@@ -1,54 +1,84 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l           *lexer.Lexer
+	diagnostics []Diagnostic
 
 	currentToken token.Token
 	peekToken    token.Token
+	unread       *token.Token
+	blockDepth   int
+	loopDepth    int // reset to 0 in function bodies
+
+	// number of lexer errors reported and the positions they start at
+	lexerErrors  int
+	lexerErrorAt map[token.Position]bool
 
 	prefixParserFns map[token.TokenType]prefixParserFn
 	infixParserFns  map[token.TokenType]infixParserFn
 }
 
 func New(lex *lexer.Lexer) *Parser {
-	p := &Parser{l: lex}
+	p := &Parser{l: lex, lexerErrorAt: make(map[token.Position]bool)}
 	p.nextToken()
 	p.nextToken()
 
 	p.prefixParserFns = make(map[token.TokenType]prefixParserFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.BIGINT, p.parseBigIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.INTERPOLATION, p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 
 	p.infixParserFns = make(map[token.TokenType]infixParserFn)
 	p.registerinfix(token.PLUS, p.parseInfixExpression)
 	p.registerinfix(token.MINUS, p.parseInfixExpression)
 	p.registerinfix(token.SLASH, p.parseInfixExpression)
 	p.registerinfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerinfix(token.PERCENT, p.parseInfixExpression)
+	p.registerinfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerinfix(token.PIPE, p.parseInfixExpression)
+	p.registerinfix(token.CARET, p.parseInfixExpression)
+	p.registerinfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerinfix(token.SHIFT_RIGHT, p.parseInfixExpression)
 	p.registerinfix(token.EQ, p.parseInfixExpression)
 	p.registerinfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerinfix(token.LT, p.parseInfixExpression)
 	p.registerinfix(token.GT, p.parseInfixExpression)
+	p.registerinfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerinfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerinfix(token.AND, p.parseInfixExpression)
+	p.registerinfix(token.OR, p.parseInfixExpression)
 	p.registerinfix(token.LPAREN, p.parseCallExpression)
 	p.registerinfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerinfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerinfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerinfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerinfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerinfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 
 	return p
 }
@@ -76,12 +106,40 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseAssignExpression parses the value of an assignment. Assignments are
+// right associative, so "a = b = 1" assigns 1 to both.
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.currentToken,
+		Target:   target,
+		Operator: p.currentToken.Literal,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.report(Diagnostic{
+			Code:    InvalidAssignment,
+			Message: fmt.Sprintf("cannot assign to %s", target.String()),
+			Span:    target.Span(),
+			Found:   p.currentToken,
+		})
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-	return &ast.CallExpression{
-		Token:     p.currentToken,
-		Function:  function,
-		Arguments: p.parseExpressionList(token.RPAREN),
+	expression := &ast.CallExpression{
+		Token:    p.currentToken,
+		Function: function,
 	}
+	expression.Arguments = p.parseExpressionList(token.RPAREN)
+	expression.Rparen = p.currentToken
+	return expression
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
@@ -94,9 +152,16 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		message := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
+		if errors.Is(err, strconv.ErrRange) {
+			message = fmt.Sprintf("integer %s overflows int64", p.currentToken.Literal)
+		}
+		p.fail(Diagnostic{
+			Code:    InvalidInteger,
+			Message: message,
+			Span:    p.currentToken.Span,
+			Found:   p.currentToken,
+		})
 	}
 
 	return &ast.IntegerLiteral{
@@ -105,6 +170,41 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	}
 }
 
+func (p *Parser) parseBigIntegerLiteral() ast.Expression {
+	digits := strings.TrimSuffix(p.currentToken.Literal, "n")
+	value, ok := new(big.Int).SetString(digits, 0)
+	if !ok {
+		p.fail(Diagnostic{
+			Code:    InvalidInteger,
+			Message: fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal),
+			Span:    p.currentToken.Span,
+			Found:   p.currentToken,
+		})
+	}
+
+	return &ast.BigIntegerLiteral{
+		Token: p.currentToken,
+		Value: value,
+	}
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+	if err != nil {
+		p.fail(Diagnostic{
+			Code:    InvalidFloat,
+			Message: fmt.Sprintf("could not parse %q as float", p.currentToken.Literal),
+			Span:    p.currentToken.Span,
+			Found:   p.currentToken,
+		})
+	}
+
+	return &ast.FloatLiteral{
+		Token: p.currentToken,
+		Value: value,
+	}
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return &ast.Boolean{
 		Token: p.currentToken,
@@ -117,9 +217,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 
 	expression := p.parseExpression(LOWEST)
 
-	if !p.expectPeekAndNext(token.RPAREN) {
-		return nil
-	}
+	p.expectPeekAndNext(token.RPAREN)
 
 	return expression
 }
@@ -127,29 +225,21 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.currentToken}
 
-	if !p.expectPeekAndNext(token.LPAREN) {
-		return nil
-	}
+	p.expectPeekAndNext(token.LPAREN)
 
 	p.nextToken()
 	expression.Condition = p.parseExpression(LOWEST)
 
-	if !p.expectPeekAndNext(token.RPAREN) {
-		return nil
-	}
+	p.expectPeekAndNext(token.RPAREN)
 
-	if !p.expectPeekAndNext(token.LBRACE) {
-		return nil
-	}
+	p.expectPeekAndNext(token.LBRACE)
 
 	expression.Consequence = p.parseBlockStatement()
 
 	if p.peekToken.Type == token.ELSE {
 		p.nextToken()
 
-		if !p.expectPeekAndNext(token.LBRACE) {
-			return nil
-		}
+		p.expectPeekAndNext(token.LBRACE)
 
 		expression.Alternative = p.parseBlockStatement()
 	}
@@ -162,17 +252,37 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		Token: p.currentToken,
 	}
 
-	if !p.expectPeekAndNext(token.LPAREN) {
-		return nil
-	}
+	p.expectPeekAndNext(token.LPAREN)
 
 	literal.Parameters = p.parseFunctionParameters()
 
-	if !p.expectPeekAndNext(token.LBRACE) {
-		return nil
-	}
+	p.expectPeekAndNext(token.LBRACE)
 
-	literal.Body = p.parseBlockStatement()
+	literal.Body = p.parseFunctionBody()
+
+	return literal
+}
+
+// parseFunctionBody parses the body of a function or macro, in which loop
+// statements can't refer to loops around the function.
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	literal := &ast.MacroLiteral{Token: p.currentToken}
+
+	p.expectPeekAndNext(token.LPAREN)
+
+	literal.Parameters = p.parseFunctionParameters()
+
+	p.expectPeekAndNext(token.LBRACE)
+
+	literal.Body = p.parseFunctionBody()
 
 	return literal
 }
@@ -183,19 +293,17 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return []*ast.Identifier{}
 	}
 
-	p.nextToken()
+	p.expectPeekAndNext(token.IDENT)
 	identifiers := []*ast.Identifier{p.parseIdentifier().(*ast.Identifier)}
 
 	for p.peekToken.Type == token.COMMA {
 		p.nextToken()
-		p.nextToken()
+		p.expectPeekAndNext(token.IDENT)
 
 		identifiers = append(identifiers, p.parseIdentifier().(*ast.Identifier))
 	}
 
-	if !p.expectPeekAndNext(token.RPAREN) {
-		return nil
-	}
+	p.expectPeekAndNext(token.RPAREN)
 
 	return identifiers
 }
@@ -206,6 +314,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		Statements: []ast.Statement{},
 	}
 
+	p.blockDepth += 1
+	defer func() { p.blockDepth -= 1 }()
+
 	p.nextToken()
 
 	for p.currentToken.Type != token.RBRACE && p.currentToken.Type != token.EOF {
@@ -216,25 +327,108 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	if p.currentToken.Type == token.EOF {
+		p.unexpectedToken(p.currentToken, token.RBRACE)
+	}
+
+	block.Rbrace = p.currentToken
 	return block
 }
 
+// Errors returns the messages of all diagnostics reported so far.
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := make([]string, 0, len(p.diagnostics))
+	for _, diagnostic := range p.diagnostics {
+		errors = append(errors, diagnostic.String())
+	}
+	return errors
+}
+
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
 }
 
 func (p *Parser) expectPeekError(expectedToken token.TokenType) {
-	msg := fmt.Sprintf(
-		"expected next token to be %s, but got %s instead",
-		expectedToken,
-		p.peekToken.Type,
-	)
-	p.errors = append(p.errors, msg)
+	p.unexpectedToken(p.peekToken, expectedToken)
+}
+
+func (p *Parser) unexpectedToken(found token.Token, expected token.TokenType) {
+	p.fail(Diagnostic{
+		Code: UnexpectedToken,
+		Message: fmt.Sprintf(
+			"expected next token to be %s, but got %s instead",
+			expected,
+			found.Type,
+		),
+		Span:     found.Span,
+		Expected: []token.TokenType{expected},
+		Found:    found,
+	})
+}
+
+// bailout is used to unwind the parser to the enclosing statement after a
+// syntax error.
+type bailout struct{}
+
+// fail records the diagnostic and abandons the current statement.
+func (p *Parser) fail(diagnostic Diagnostic) {
+	p.report(diagnostic)
+	panic(bailout{})
+}
+
+// report records a diagnostic without stopping the current statement.
+// Diagnostics about tokens that the lexer already reported are dropped.
+func (p *Parser) report(diagnostic Diagnostic) {
+	found := diagnostic.Found
+	if found.Type == token.ILLEGAL && p.lexerErrorAt[found.Span.Start] {
+		return
+	}
+	p.diagnostics = append(p.diagnostics, diagnostic)
+}
+
+// synchronize skips the rest of a statement after a syntax error. It stops
+// on a semicolon or in front of the closing brace of the enclosing block,
+// so that parsing can resume with the next statement.
+func (p *Parser) synchronize() {
+	if p.currentToken.Type == token.RBRACE && p.blockDepth > 0 {
+		p.unreadToken()
+		return
+	}
+
+	for p.currentToken.Type != token.SEMICOLON &&
+		p.peekToken.Type != token.EOF &&
+		!(p.peekToken.Type == token.RBRACE && p.blockDepth > 0) {
+		p.nextToken()
+	}
 }
 
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekToken
+	if p.unread != nil {
+		p.peekToken = *p.unread
+		p.unread = nil
+		return
+	}
 	p.peekToken = p.l.NextToken()
+
+	for _, err := range p.l.Errors()[p.lexerErrors:] {
+		p.report(Diagnostic{
+			Code:    InvalidToken,
+			Message: err.Message,
+			Span:    err.Span,
+			Found:   p.peekToken,
+		})
+		p.lexerErrors++
+		p.lexerErrorAt[err.Span.Start] = true
+	}
+}
+
+// unreadToken makes the current token the next one returned by nextToken.
+func (p *Parser) unreadToken() {
+	peek := p.peekToken
+	p.unread = &peek
+	p.peekToken = p.currentToken
+	p.currentToken = token.Token{Type: token.ILLEGAL}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -242,20 +436,42 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	for p.currentToken.Type != token.EOF {
 		statement := p.parseStatement()
-		program.Statements = append(program.Statements, statement)
+		if statement != nil {
+			program.Statements = append(program.Statements, statement)
+		}
 		p.nextToken()
 	}
 
+	p.checkLoopControl(program.Statements, false)
+
 	return program
 
 }
 
-func (p *Parser) parseStatement() ast.Statement {
+func (p *Parser) parseStatement() (statement ast.Statement) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.synchronize()
+			statement = nil
+		}
+	}()
+
 	switch p.currentToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -264,27 +480,25 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	statement := &ast.LetStatement{Token: p.currentToken}
 
-	if !p.expectPeekAndNext(token.IDENT) {
-		return nil
-	}
+	p.expectPeekAndNext(token.IDENT)
 
 	statement.Name = &ast.Identifier{
 		Token: p.currentToken,
 		Value: p.currentToken.Literal,
 	}
 
-	if !p.expectPeekAndNext(token.ASSIGN) {
-		return nil
-	}
+	p.expectPeekAndNext(token.ASSIGN)
 
 	p.nextToken()
 
 	statement.Value = p.parseExpression(LOWEST)
 
-	if !p.expectPeekAndNext(token.SEMICOLON) {
-		return nil
+	if fn, ok := statement.Value.(*ast.FunctionLiteral); ok {
+		fn.Name = statement.Name.Value
 	}
 
+	p.expectPeekAndNext(token.SEMICOLON)
+
 	return statement
 }
 
@@ -295,36 +509,153 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	statement.ReturnValue = p.parseExpression(LOWEST)
 
-	if !p.expectPeekAndNext(token.SEMICOLON) {
-		return nil
+	p.expectPeekAndNext(token.SEMICOLON)
+
+	return statement
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	statement := &ast.WhileStatement{Token: p.currentToken}
+
+	p.expectPeekAndNext(token.LPAREN)
+
+	p.nextToken()
+	statement.Condition = p.parseExpression(LOWEST)
+
+	p.expectPeekAndNext(token.RPAREN)
+
+	p.expectPeekAndNext(token.LBRACE)
+
+	statement.Body = p.parseLoopBody()
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
 	}
 
 	return statement
 }
 
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	statement := &ast.ForStatement{Token: p.currentToken}
+
+	p.expectPeekAndNext(token.LPAREN)
+
+	p.expectPeekAndNext(token.IDENT)
+	statement.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if p.peekToken.Type == token.COMMA {
+		p.nextToken()
+		p.expectPeekAndNext(token.IDENT)
+
+		statement.Key = statement.Value
+		statement.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	}
+
+	p.expectPeekAndNext(token.IN)
+
+	p.nextToken()
+	statement.Iterable = p.parseExpression(LOWEST)
+
+	p.expectPeekAndNext(token.RPAREN)
+
+	p.expectPeekAndNext(token.LBRACE)
+
+	statement.Body = p.parseLoopBody()
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return statement
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth += 1
+	defer func() { p.loopDepth -= 1 }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	statement := &ast.BreakStatement{Token: p.currentToken}
+	p.checkInsideLoop()
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return statement
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	statement := &ast.ContinueStatement{Token: p.currentToken}
+	p.checkInsideLoop()
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return statement
+}
+
+func (p *Parser) checkInsideLoop() {
+	if p.loopDepth > 0 {
+		return
+	}
+
+	p.report(Diagnostic{
+		Code:    OutsideLoop,
+		Message: fmt.Sprintf("%s outside loop", p.currentToken.Literal),
+		Span:    p.currentToken.Span,
+		Found:   p.currentToken,
+	})
+}
+
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = or +=
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
+	SHIFT       // << or >>
 	SUM         // +
-	PRODUCT     // *
-	PREFIX      // -X or !X
+	PRODUCT     // * or %
+	PREFIX      // -X, !X or ~X
 	CALL        // function(X)
 	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PIPE:            BITOR,
+	token.CARET:           BITXOR,
+	token.AMPERSAND:       BITAND,
+	token.SHIFT_LEFT:      SHIFT,
+	token.SHIFT_RIGHT:     SHIFT,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
@@ -343,12 +674,15 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix, ok := p.prefixParserFns[p.currentToken.Type]
 	if !ok {
-		msg := fmt.Sprintf(
-			"no prefix parse function for %s found",
-			p.currentToken.Type,
-		)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.fail(Diagnostic{
+			Code: NoPrefixParser,
+			Message: fmt.Sprintf(
+				"no prefix parse function for %s found",
+				p.currentToken.Type,
+			),
+			Span:  p.currentToken.Span,
+			Found: p.currentToken,
+		})
 	}
 	leftExp := prefix()
 
@@ -366,13 +700,11 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return leftExp
 }
 
-func (p *Parser) expectPeekAndNext(tokenType token.TokenType) bool {
+func (p *Parser) expectPeekAndNext(tokenType token.TokenType) {
 	if p.peekToken.Type != tokenType {
 		p.expectPeekError(tokenType)
-		return false
 	}
 	p.nextToken()
-	return true
 }
 
 func (p *Parser) peekPrecendece() int {
@@ -411,11 +743,41 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	}
 }
 
-func (p *Parser) parseArrayLiteral() ast.Expression {
-	return &ast.ArrayLiteral{
-		Token:    p.currentToken,
-		Elements: p.parseExpressionList(token.RBRACKET),
+// parseInterpolatedString parses the tokens of a string literal with
+// interpolated expressions. Empty text between them is left out of Parts.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.currentToken}
+
+	for {
+		if p.currentToken.Literal != "" {
+			str.Parts = append(str.Parts, &ast.StringLiteral{
+				Token: p.currentToken,
+				Value: p.currentToken.Literal,
+			})
+		}
+		if p.currentToken.Type == token.STRING {
+			break
+		}
+
+		p.nextToken()
+		str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+
+		if p.peekToken.Type != token.INTERPOLATION {
+			p.expectPeekAndNext(token.STRING)
+		} else {
+			p.nextToken()
+		}
 	}
+
+	str.End = p.currentToken
+	return str
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currentToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.currentToken
+	return array
 }
 
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
@@ -433,9 +795,7 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		elements = append(elements, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeekAndNext(end) {
-		return nil
-	}
+	p.expectPeekAndNext(end)
 
 	return elements
 }
@@ -445,40 +805,33 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
 
-	if !p.expectPeekAndNext(token.RBRACKET) {
-		return nil
-	}
+	p.expectPeekAndNext(token.RBRACKET)
 
+	exp.Rbracket = p.currentToken
 	return exp
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
-	hash := &ast.HashLiteral{
-		Token: p.currentToken,
-		Pairs: make(map[ast.Expression]ast.Expression),
-	}
+	hash := &ast.HashLiteral{Token: p.currentToken}
 
 	for p.peekToken.Type != token.RBRACE {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
 
-		if !p.expectPeekAndNext(token.COLON) {
-			return nil
-		}
+		p.expectPeekAndNext(token.COLON)
 
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		
-		hash.Pairs[key] = value
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
 
-		if p.peekToken.Type != token.RBRACE && !p.expectPeekAndNext(token.COMMA) {
-			return nil
+		if p.peekToken.Type != token.RBRACE {
+			p.expectPeekAndNext(token.COMMA)
 		}
 	}
 
-	if !p.expectPeekAndNext(token.RBRACE) {
-		return nil
-	}
+	p.expectPeekAndNext(token.RBRACE)
 
+	hash.Rbrace = p.currentToken
 	return hash
 }
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -139,6 +141,141 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF;", 255},
+		{"0Xff;", 255},
+		{"0o755;", 493},
+		{"0b1010;", 10},
+		{"1_000_000;", 1000000},
+		{"0xFF_FF;", 65535},
+		{"9223372036854775807;", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestBigIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"10n;", "10"},
+		{"0xFFn;", "255"},
+		{"1_000n;", "1000"},
+		{"123456789012345678901234567890n;", "123456789012345678901234567890"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.BigIntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.BigIntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value.String() != tt.expected {
+			t.Errorf("literal.Value not %s. got=%s", tt.expected, literal.Value)
+		}
+		if literal.String() != strings.TrimSuffix(tt.input, ";") {
+			t.Errorf("literal.String() wrong. got=%q", literal.String())
+		}
+	}
+}
+
+func TestInvalidIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"0x;", `could not parse "0x" as integer`},
+		{"0b102;", `could not parse "0b102" as integer`},
+		{"0o8;", `could not parse "0o8" as integer`},
+		{"0xFG;", `could not parse "0xFG" as integer`},
+		{"1__000;", `could not parse "1__000" as integer`},
+		{"1_;", `could not parse "1_" as integer`},
+		{"9223372036854775808;", "integer 9223372036854775808 overflows int64"},
+		{"0x1_0000_0000_0000_0000;", "integer 0x1_0000_0000_0000_0000 overflows int64"},
+		{"0xn;", `could not parse "0xn" as integer`},
+		{"1__0n;", `could not parse "1__0n" as integer`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("%q: wrong number of diagnostics. got=%d", tt.input, len(diagnostics))
+		}
+		if diagnostics[0].Code != InvalidInteger {
+			t.Errorf("%q: wrong code. want=%q, got=%q", tt.input, InvalidInteger, diagnostics[0].Code)
+		}
+		if diagnostics[0].Message != tt.expectedMessage {
+			t.Errorf("%q: wrong message. want=%q, got=%q",
+				tt.input, tt.expectedMessage, diagnostics[0].Message)
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5;", 1.5},
+		{".25;", 0.25},
+		{"1e3;", 1000},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestInvalidFloatLiteral(t *testing.T) {
+	p := New(lexer.New("1e999;"))
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. got=%d", len(diagnostics))
+	}
+	if diagnostics[0].Code != InvalidFloat {
+		t.Errorf("wrong code. want=%q, got=%q", InvalidFloat, diagnostics[0].Code)
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -151,6 +288,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		{"-foobar;", "-", "foobar"},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
+		{"~5;", "~", 5},
 	}
 
 	for _, tt := range prefixTests {
@@ -199,6 +337,12 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
 		{"foobar + barfoo;", "foobar", "+", "barfoo"},
 		{"foobar - barfoo;", "foobar", "-", "barfoo"},
 		{"foobar * barfoo;", "foobar", "*", "barfoo"},
@@ -289,6 +433,46 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
 		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & 1 == 0",
+			"((a & 1) == 0)",
+		},
+		{
+			"1 << a + 1 < b >> 2",
+			"((1 << (a + 1)) < (b >> 2))",
+		},
+		{
+			"a * b % c",
+			"((a * b) % c)",
+		},
+		{
+			"~a & ~-b",
+			"((~a) & (~(-b)))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == 1 && !b || c < 2",
+			"(((a == 1) && (!b)) || (c < 2))",
+		},
+		{
+			"x = a || b",
+			"(x = (a || b))",
+		},
 		{
 			"true",
 			"true",
@@ -509,6 +693,251 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { x; break; continue; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body is not 3 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("body.Statements[1] is not ast.BreakStatement. got=%T",
+			stmt.Body.Statements[1])
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("body.Statements[2] is not ast.ContinueStatement. got=%T",
+			stmt.Body.Statements[2])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedKey      string
+		expectedValue    string
+		expectedIterable string
+		expectedString   string
+	}{
+		{"for (x in xs) { x }", "", "x", "xs", "for (x in xs) x"},
+		{"for (k, v in [1, 2]) { k }", "k", "v", "[1, 2]", "for (k, v in [1, 2]) k"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T",
+				program.Statements[0])
+		}
+
+		if tt.expectedKey == "" && stmt.Key != nil {
+			t.Errorf("stmt.Key is not nil. got=%s", stmt.Key)
+		}
+		if tt.expectedKey != "" && !testIdentifier(t, stmt.Key, tt.expectedKey) {
+			return
+		}
+		if !testIdentifier(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+		if stmt.Iterable.String() != tt.expectedIterable {
+			t.Errorf("stmt.Iterable wrong. want=%q, got=%q",
+				tt.expectedIterable, stmt.Iterable.String())
+		}
+		if stmt.String() != tt.expectedString {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q",
+				tt.expectedString, stmt.String())
+		}
+	}
+}
+
+func TestLoopControlInExpression(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"while (x) { let y = if (c) { break }; }", "1:30: break inside an expression whose value is used"},
+		{"while (x) { f(if (c) { 1 } else { continue }) }", "1:35: continue inside an expression whose value is used"},
+		{"while (x) { if (c) { break } + 1 }", "1:22: break inside an expression whose value is used"},
+		{"while (x) { if (c) { if (d) { break } } else { continue } }", ""},
+		{"while (x) { let f = fn() { while (y) { if (c) { break } } }; }", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if tt.expectedMessage == "" {
+			if len(errors) != 0 {
+				t.Errorf("unexpected errors for %q: %q", tt.input, errors)
+			}
+			continue
+		}
+
+		if len(errors) != 1 || errors[0] != tt.expectedMessage {
+			t.Errorf("wrong errors for %q. want=%q, got=%q",
+				tt.input, tt.expectedMessage, errors)
+		}
+		if p.Diagnostics()[0].Code != LoopControlInExpression {
+			t.Errorf("wrong code. got=%s", p.Diagnostics()[0].Code)
+		}
+	}
+}
+
+func TestLoopStatementsOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"break;", "1:1: break outside loop"},
+		{"if (x) { continue }", "1:10: continue outside loop"},
+		{"while (x) { fn() { break } }", "1:20: break outside loop"},
+		{"while (x) { fn() { while (y) { break } }; continue }", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if tt.expectedMessage == "" {
+			if len(errors) != 0 {
+				t.Errorf("unexpected errors for %q: %q", tt.input, errors)
+			}
+			continue
+		}
+
+		if len(errors) != 1 || errors[0] != tt.expectedMessage {
+			t.Errorf("wrong errors for %q. want=%q, got=%q",
+				tt.input, tt.expectedMessage, errors)
+		}
+		if p.Diagnostics()[0].Code != OutsideLoop {
+			t.Errorf("wrong code. got=%s", p.Diagnostics()[0].Code)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedOperator string
+		expected         string
+	}{
+		{"x = 5;", "=", "(x = 5)"},
+		{"x += y * 2;", "+=", "(x += (y * 2))"},
+		{"x -= 1;", "-=", "(x -= 1)"},
+		{"x *= 2;", "*=", "(x *= 2)"},
+		{"x /= 2;", "/=", "(x /= 2)"},
+		{"a[1] = b == c;", "=", "((a[1]) = (b == c))"},
+		{"h[k][0] += 1;", "+=", "(((h[k])[0]) += 1)"},
+		{"a = b = 1;", "=", "(a = (b = 1))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if exp.Operator != tt.expectedOperator {
+			t.Errorf("exp.Operator is not %q. got=%q", tt.expectedOperator, exp.Operator)
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, exp.String())
+		}
+	}
+}
+
+func TestInvalidAssignmentTargets(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 = 2;", "1:1: cannot assign to 1"},
+		{"f() = 2;", "1:1: cannot assign to f()"},
+		{"x + y += 2;", "1:1: cannot assign to (x + y)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expectedMessage {
+			t.Errorf("wrong errors for %q. want=%q, got=%q",
+				tt.input, tt.expectedMessage, errors)
+			continue
+		}
+		if p.Diagnostics()[0].Code != InvalidAssignment {
+			t.Errorf("wrong code. got=%s", p.Diagnostics()[0].Code)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `
+// the answer
+let answer = 42; /* inline */
+fn() {
+	// nothing to see
+};
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	let, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+	}
+	if len(let.Token.Comments) != 1 || let.Token.Comments[0].Text != "// the answer" {
+		t.Errorf("wrong comments on let token. got=%+v", let.Token.Comments)
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -697,6 +1126,82 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStringExpression(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParts  []string
+		expectedString string
+	}{
+		{`"Hello ${name}!"`, []string{"Hello ", "name", "!"}, `"Hello ${name}!"`},
+		{`"${a+b}"`, []string{"(a + b)"}, `"${(a + b)}"`},
+		{`"${x}${y}"`, []string{"x", "y"}, `"${x}${y}"`},
+		{`"n: ${len("${n}")}"`, []string{"n: ", `len("${n}")`}, `"n: ${len("${n}")}"`},
+		{`"${ "a" }"`, []string{"a"}, `"a"`},
+		{`"${ "a" + "b" }!"`, []string{"(a + b)", "!"}, `"${(a + b)}!"`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		str, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+		}
+
+		if len(str.Parts) != len(tt.expectedParts) {
+			t.Fatalf("wrong number of parts. want=%d, got=%d",
+				len(tt.expectedParts), len(str.Parts))
+		}
+		for i, part := range str.Parts {
+			if part.String() != tt.expectedParts[i] {
+				t.Errorf("part %d wrong. want=%q, got=%q", i, tt.expectedParts[i], part.String())
+			}
+		}
+
+		if str.String() != tt.expectedString {
+			t.Errorf("str.String() wrong. want=%q, got=%q", tt.expectedString, str.String())
+		}
+	}
+}
+
+func TestInvalidInterpolatedString(t *testing.T) {
+	p := New(lexer.New(`let x = "a ${1 2}";`))
+	p.ParseProgram()
+
+	expected := "1:16: expected next token to be STRING, but got INT instead"
+	if errors := p.Errors(); len(errors) == 0 || errors[0] != expected {
+		t.Errorf("wrong errors. want=%q first, got=%q", expected, errors)
+	}
+
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`"${}"`, "1:2: empty interpolation"},
+		{`"a ${} b ${x}"`, "1:4: empty interpolation"},
+		{`"${x}${ }"`, "1:6: empty interpolation"},
+		{`"${"a"}${}"`, "1:8: empty interpolation"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expectedError, errors)
+			continue
+		}
+		if p.Diagnostics()[0].Code != InvalidToken {
+			t.Errorf("wrong code. got=%s", p.Diagnostics()[0].Code)
+		}
+	}
+}
+
 func TestParsingEmptyArrayLiterals(t *testing.T) {
 	input := "[]"
 
@@ -805,7 +1310,8 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		literal, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
@@ -815,6 +1321,10 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		expectedValue := expected[literal.String()]
 		testIntegerLiteral(t, value, expectedValue)
 	}
+
+	if hash.String() != "{one:1, two:2, three:3}" {
+		t.Errorf("pairs not in source order. got=%s", hash.String())
+	}
 }
 
 func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
@@ -840,7 +1350,8 @@ func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		boolean, ok := key.(*ast.Boolean)
 		if !ok {
 			t.Errorf("key is not ast.BooleanLiteral. got=%T", key)
@@ -876,7 +1387,8 @@ func TestParsingHashLiteralsIntegerKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		integer, ok := key.(*ast.IntegerLiteral)
 		if !ok {
 			t.Errorf("key is not ast.IntegerLiteral. got=%T", key)
@@ -919,7 +1431,8 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		},
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		literal, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
@@ -936,6 +1449,210 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestNodeSpans(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y;
+};
+add(1, [2, 3][0]);`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	letStmt := program.Statements[0].(*ast.LetStatement)
+	fn := letStmt.Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+
+	tests := []struct {
+		node          ast.Node
+		expectedStart string
+		expectedEnd   string
+	}{
+		{program, "1:1", "4:18"},
+		{letStmt, "1:1", "3:2"},
+		{fn, "1:11", "3:2"},
+		{body.Expression, "2:3", "2:8"},
+		{call, "4:1", "4:18"},
+		{call.Arguments[1], "4:8", "4:17"},
+	}
+
+	for i, tt := range tests {
+		span := tt.node.Span()
+		if span.Start.String() != tt.expectedStart {
+			t.Errorf("tests[%d] - start wrong. expected=%s, got=%s",
+				i, tt.expectedStart, span.Start)
+		}
+		if span.End.String() != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%s, got=%s",
+				i, tt.expectedEnd, span.End)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	input := "let x = 5;\nlet = 10;"
+
+	l := lexer.NewWithFilename("test.mk", input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+
+	expected := "test.mk:2:5: expected next token to be IDENT, but got = instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `
+let x 5;
+let = 10;
+let y = 1;
+let f = fn(a) {
+  a + ;
+  a * 2
+};
+let 838383;
+y;
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expected := []struct {
+		code     Code
+		position string
+		expected []token.TokenType
+		found    token.TokenType
+	}{
+		{UnexpectedToken, "2:7", []token.TokenType{token.ASSIGN}, token.INT},
+		{UnexpectedToken, "3:5", []token.TokenType{token.IDENT}, token.ASSIGN},
+		{NoPrefixParser, "6:7", nil, token.SEMICOLON},
+		{UnexpectedToken, "9:5", []token.TokenType{token.IDENT}, token.INT},
+	}
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. want=%d, got=%d (%q)",
+			len(expected), len(diagnostics), p.Errors())
+	}
+
+	for i, tt := range expected {
+		diagnostic := diagnostics[i]
+		if diagnostic.Severity != SeverityError {
+			t.Errorf("diagnostics[%d] - severity wrong. got=%s", i, diagnostic.Severity)
+		}
+		if diagnostic.Code != tt.code {
+			t.Errorf("diagnostics[%d] - code wrong. want=%s, got=%s",
+				i, tt.code, diagnostic.Code)
+		}
+		if diagnostic.Span.Start.String() != tt.position {
+			t.Errorf("diagnostics[%d] - position wrong. want=%s, got=%s",
+				i, tt.position, diagnostic.Span.Start)
+		}
+		if fmt.Sprint(diagnostic.Expected) != fmt.Sprint(tt.expected) {
+			t.Errorf("diagnostics[%d] - expected tokens wrong. want=%v, got=%v",
+				i, tt.expected, diagnostic.Expected)
+		}
+		if diagnostic.Found.Type != tt.found {
+			t.Errorf("diagnostics[%d] - found token wrong. want=%s, got=%s",
+				i, tt.found, diagnostic.Found.Type)
+		}
+	}
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d",
+			len(program.Statements))
+	}
+
+	for _, statement := range program.Statements {
+		if statement == nil {
+			t.Fatalf("program contains nil statement")
+		}
+	}
+
+	fn := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if fn.Body.String() != "(a * 2)" {
+		t.Errorf("function body not recovered. got=%q", fn.Body.String())
+	}
+
+	if program.Statements[2].String() != "y" {
+		t.Errorf("last statement wrong. got=%q", program.Statements[2].String())
+	}
+}
+
+func TestUnterminatedBlock(t *testing.T) {
+	l := lexer.New("if (x) { x")
+	p := New(l)
+	program := p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want=1, got=%d (%q)",
+			len(diagnostics), p.Errors())
+	}
+	if diagnostics[0].Found.Type != token.EOF {
+		t.Errorf("found token wrong. want=EOF, got=%s", diagnostics[0].Found.Type)
+	}
+	if len(program.Statements) != 0 {
+		t.Errorf("program.Statements not empty. got=%d", len(program.Statements))
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -1081,3 +1798,29 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedMessages []string
+	}{
+		{`let x = "abc`, []string{"1:9: unterminated string"}},
+		{`puts("a\qb"); let = 1;`, []string{`1:8: invalid escape sequence \q`, "1:19: expected next token to be IDENT, but got = instead"}},
+		{"let x = 1; x /* abc", []string{"1:14: unterminated comment"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if fmt.Sprint(errors) != fmt.Sprint(tt.expectedMessages) {
+			t.Errorf("wrong errors for %q. want=%q, got=%q",
+				tt.input, tt.expectedMessages, errors)
+			continue
+		}
+		if p.Diagnostics()[0].Code != InvalidToken {
+			t.Errorf("wrong code. got=%s", p.Diagnostics()[0].Code)
+		}
+	}
+}
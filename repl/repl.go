@@ -2,19 +2,20 @@ package repl
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"monkey/evaluator"
-	"monkey/lexer"
+	"monkey/interpreter"
 	"monkey/object"
-	"monkey/parser"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
+// Start reads lines from in and runs each of them with interp. Results and
+// errors are written to out.
+func Start(in io.Reader, out io.Writer, interp *interpreter.Interpreter) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
 
 	for {
 		fmt.Fprint(out, PROMPT)
@@ -22,20 +23,20 @@ func Start(in io.Reader, out io.Writer) {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+		evaluated, err := interp.Run(context.Background(), scanner.Text())
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			for _, err := range p.Errors() {
-				io.WriteString(out, "\t"+err+"\n")
+		var syntaxErr *interpreter.SyntaxError
+		var runtimeErr *object.Error
+		switch {
+		case errors.As(err, &syntaxErr):
+			for _, d := range syntaxErr.Diagnostics {
+				io.WriteString(out, "\t"+d.String()+"\n")
 			}
-			continue
-		}
-
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
+		case errors.As(err, &runtimeErr):
+			io.WriteString(out, runtimeErr.Inspect()+"\n\n"+runtimeErr.StackTrace())
+		case err != nil:
+			io.WriteString(out, "\t"+err.Error()+"\n")
+		case evaluated != nil:
 			io.WriteString(out, evaluated.Inspect()+"\n")
 		}
 	}
@@ -1,12 +1,60 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Span    Span
+
+	// Comments are the comments between the previous token and this one.
+	// The lexer keeps them as trivia so that tools can preserve them; the
+	// comments at the end of the input are attached to the EOF token.
+	Comments []Comment
+}
+
+// Comment is a "//" line comment or a "/* */" block comment. Text
+// includes the comment markers but not the newline ending a line comment.
+type Comment struct {
+	Text string
+	Span Span
+}
+
+// Position is a location in the source code. Offset is a zero based byte
+// offset, Line and Column start at 1. Column counts characters, not bytes.
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
 }
 
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	out := p.Filename
+	if p.IsValid() {
+		if out != "" {
+			out += ":"
+		}
+		out += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if out == "" {
+		out = "-"
+	}
+	return out
+}
+
+// Span covers the source code from Start up to, but not including, End.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) String() string { return s.Start.String() }
+
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
@@ -14,8 +62,15 @@ const (
 	// Identifiers + Literals
 	IDENT  = "IDENT"
 	INT    = "INT"
+	BIGINT = "BIGINT" // an integer with an n suffix, like 10n
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
+	// INTERPOLATION is the part of a string literal in front of "${". The
+	// tokens of the interpolated expression follow, then the rest of the
+	// string as a STRING or another INTERPOLATION.
+	INTERPOLATION = "INTERPOLATION"
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -23,12 +78,30 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+
+	AMPERSAND   = "&"
+	PIPE        = "|"
+	CARET       = "^"
+	TILDE       = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
-	LT = "<"
-	GT = ">"
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
+
+	AND = "&&"
+	OR  = "||"
 
 	// Delimiters
 	COMMA     = ","
@@ -49,6 +122,12 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MACRO    = "MACRO"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 )
 
 var Keywords = map[string]TokenType{
@@ -59,6 +138,13 @@ var Keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"macro":  MACRO,
+
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 }
 
 func LookupIdentifier(ident string) TokenType {
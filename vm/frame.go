@@ -0,0 +1,33 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+)
+
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// Pos returns the source position of the instruction being executed.
+func (f *Frame) Pos() token.Position {
+	return f.cl.Fn.SourceMap.Lookup(f.ip)
+}
+
+func (f *Frame) function() string {
+	if f.cl.Fn.Name != "" {
+		return f.cl.Fn.Name
+	}
+	return object.AnonymousFunction
+}
@@ -0,0 +1,666 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+)
+
+const (
+	StackSize  = 2048
+	GlobalSize = 65536
+	MaxFrames  = evaluator.DefaultMaxDepth
+)
+
+var (
+	NULL  = evaluator.NULL
+	TRUE  = evaluator.TRUE
+	FALSE = evaluator.FALSE
+)
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpGreaterThan:  ">",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterEqual: ">=",
+}
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+	builtins    map[string]*object.Builtin
+	limits      evaluator.Limits
+	overflow    evaluator.Overflow
+	meter       *evaluator.Meter
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	lastPopped object.Object
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalSize))
+}
+
+// NewWithGlobalsStore returns a VM that uses the globals of an earlier run,
+// as needed by the REPL.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	return NewWithConfig(bytecode, globals, evaluator.Config{})
+}
+
+// NewWithConfig is like NewWithGlobalsStore but takes the builtins, limits
+// and overflow policy from config.
+func NewWithConfig(
+	bytecode *compiler.Bytecode,
+	globals []object.Object,
+	config evaluator.Config,
+) *VM {
+	builtins := config.Builtins
+	if builtins == nil {
+		builtins = evaluator.NewBuiltins(os.Stdout)
+	}
+
+	mainFn := &object.CompiledFunction{
+		Name:         object.MainFunction,
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+	}
+	mainFrame := NewFrame(&object.Closure{Fn: mainFn}, 0)
+
+	maxFrames := config.Limits.MaxDepth
+	if maxFrames == 0 {
+		maxFrames = MaxFrames
+	}
+	frames := make([]*Frame, maxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     globals,
+		globalNames: bytecode.GlobalNames,
+		builtins:    builtins,
+		limits:      config.Limits,
+		overflow:    config.Overflow,
+		stack:       make([]object.Object, StackSize),
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// Run executes the bytecode and returns its result, which is the value of
+// the last expression statement, the value of a top level return statement
+// or the first error. It stops with an error of kind object.LimitError
+// when ctx is done or a limit is exceeded.
+func (vm *VM) Run(ctx context.Context) object.Object {
+	vm.meter = evaluator.NewMeter(ctx, vm.limits)
+
+	if result := vm.execute(0); result != nil {
+		return result
+	}
+	return vm.lastPopped
+}
+
+// execute runs instructions until the frame at index depth returns or the
+// main function ends. It returns nil, or an error or the value of a top
+// level return statement, which end the program.
+func (vm *VM) execute(depth int) object.Object {
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if err := vm.meter.Step(); err != nil {
+			return vm.positioned(err)
+		}
+
+		vm.currentFrame().ip += 1
+
+		ip := vm.currentFrame().ip
+		ins := vm.currentFrame().Instructions()
+		op := code.Opcode(ins[ip])
+
+		var result object.Object
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			vm.currentFrame().ip += 4
+			vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan,
+			code.OpLessEqual, code.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.pop()
+			result = vm.pushResult(vm.allocate(evaluator.InfixOperation(infixOperators[op], left, right, vm.overflow)))
+
+		case code.OpMinus:
+			result = vm.pushResult(vm.allocate(evaluator.PrefixOperation("-", vm.pop(), vm.overflow)))
+
+		case code.OpBitNot:
+			result = vm.pushResult(vm.allocate(evaluator.PrefixOperation("~", vm.pop(), vm.overflow)))
+
+		case code.OpBang:
+			result = vm.pushResult(evaluator.PrefixOperation("!", vm.pop(), vm.overflow))
+
+		case code.OpTrue:
+			vm.push(TRUE)
+
+		case code.OpFalse:
+			vm.push(FALSE)
+
+		case code.OpNull:
+			vm.push(NULL)
+
+		case code.OpJump:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			vm.currentFrame().ip += 4
+
+			condition := vm.pop()
+			if !evaluator.IsTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			result = vm.pushResult(vm.global(int(globalIndex)))
+
+		case code.OpAssignGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			result = vm.assignGlobal(int(globalIndex), vm.pop())
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			frame := vm.currentFrame()
+			value := vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+			vm.push(value)
+
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			frame := vm.currentFrame()
+			vm.push(vm.localCell(frame.basePointer + int(localIndex)))
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.push(vm.currentFrame().cl.Free[freeIndex].Value)
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.currentFrame().cl.Free[freeIndex].Value = vm.pop()
+
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.push(vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpCurrentClosure:
+			vm.push(vm.currentFrame().cl)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+
+			result = vm.pushResult(vm.allocate(&object.Array{Elements: elements}))
+
+		case code.OpArrayExtend:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			arr := vm.stack[vm.sp-numElements-1].(*object.Array)
+			arr.Elements = append(arr.Elements, vm.stack[vm.sp-numElements:vm.sp]...)
+			vm.sp = vm.sp - numElements
+
+			if err := vm.meter.Grow(numElements); err != nil {
+				result = err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash := &object.Hash{}
+			err := vm.setPairs(hash, vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err != nil {
+				result = err
+			} else {
+				result = vm.pushResult(vm.allocate(hash))
+			}
+
+		case code.OpHashExtend:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash := vm.stack[vm.sp-numElements-1].(*object.Hash)
+			size := hash.Len()
+			err := vm.setPairs(hash, vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err != nil {
+				result = err
+			} else if err := vm.meter.Grow(hash.Len() - size); err != nil {
+				result = err
+			}
+
+		case code.OpInterpolate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			parts := vm.stack[vm.sp-numParts : vm.sp]
+			str := evaluator.Interpolate(parts)
+			vm.sp = vm.sp - numParts
+
+			result = vm.pushResult(vm.allocate(str))
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			result = vm.pushResult(evaluator.IndexOperation(left, index))
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			result = vm.pushResult(evaluator.IndexAssignment(left, index, value))
+
+		case code.OpDup2:
+			first, second := vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+			vm.push(first)
+			vm.push(second)
+
+		case code.OpCall:
+			numArgs := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			result = vm.executeCall(int(numArgs))
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if vm.framesIndex == 1 {
+				return returnValue
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			vm.push(returnValue)
+
+		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				return NULL
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			vm.push(NULL)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			numFree := code.ReadUint16(ins[ip+5:])
+			vm.currentFrame().ip += 6
+			result = vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpQuote:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			numValues := int(code.ReadUint16(ins[ip+5:]))
+			vm.currentFrame().ip += 6
+			result = vm.pushQuote(int(constIndex), numValues)
+
+		case code.OpIter:
+			iterator, err := evaluator.NewIterator(vm.pop())
+			if err != nil {
+				result = err
+			} else {
+				vm.push(iterator)
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			numValues := int(code.ReadUint8(ins[ip+5:]))
+			vm.currentFrame().ip += 5
+			result = vm.iterNext(pos, numValues)
+
+		default:
+			result = newError("unknown opcode %d", op)
+		}
+
+		if err, ok := result.(*object.Error); ok {
+			return vm.positioned(err)
+		}
+	}
+
+	return nil
+}
+
+// positioned sets the position and trace of err unless it has them.
+func (vm *VM) positioned(err *object.Error) *object.Error {
+	if !err.Pos.IsValid() {
+		err.Pos = vm.currentFrame().Pos()
+		err.Trace = vm.trace()
+	}
+	return err
+}
+
+// allocate counts obj against the allocation limit. It returns obj, or an
+// error if the limit is exceeded.
+func (vm *VM) allocate(obj object.Object) object.Object {
+	if err := vm.meter.Allocate(obj); err != nil {
+		return err
+	}
+	return obj
+}
+
+// Call calls fn with args and returns the result. fn must have been
+// created by a VM that ran the bytecode this VM was created with.
+func (vm *VM) Call(ctx context.Context, fn object.Object, args ...object.Object) object.Object {
+	start := len(vm.constants)
+	constants := make([]object.Object, start, start+len(args)+1)
+	copy(constants, vm.constants)
+	vm.constants = append(append(constants, fn), args...)
+
+	ins := code.Make(code.OpConstant, start)
+	for i := range args {
+		ins = append(ins, code.Make(code.OpConstant, start+1+i)...)
+	}
+	ins = append(ins, code.Make(code.OpCall, len(args))...)
+	ins = append(ins, code.Make(code.OpPop)...)
+
+	mainFn := &object.CompiledFunction{Name: object.MainFunction, Instructions: ins}
+	vm.frames[0] = NewFrame(&object.Closure{Fn: mainFn}, 0)
+	vm.framesIndex = 1
+	vm.sp = 0
+
+	return vm.Run(ctx)
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) object.Object {
+	if vm.framesIndex >= len(vm.frames) {
+		return evaluator.StackOverflow()
+	}
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex += 1
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex -= 1
+	return vm.frames[vm.framesIndex]
+}
+
+// trace returns the call stack, innermost call first.
+func (vm *VM) trace() []object.Frame {
+	trace := make([]object.Frame, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		trace = append(trace, object.Frame{Function: frame.function(), Pos: frame.Pos()})
+	}
+	return trace
+}
+
+func (vm *VM) push(obj object.Object) {
+	vm.reserve(1)
+	vm.stack[vm.sp] = obj
+	vm.sp += 1
+}
+
+// reserve grows the stack to hold n more values. It starts with StackSize
+// slots; its size is bounded by the frame limit.
+func (vm *VM) reserve(n int) {
+	if need := vm.sp + n; need > len(vm.stack) {
+		grown := make([]object.Object, max(need, 2*len(vm.stack)))
+		copy(grown, vm.stack)
+		vm.stack = grown
+	}
+}
+
+// pushResult pushes the result of an operation unless it is an error,
+// which is returned instead.
+func (vm *VM) pushResult(obj object.Object) object.Object {
+	if _, ok := obj.(*object.Error); ok {
+		return obj
+	}
+	vm.push(obj)
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	obj := vm.stack[vm.sp-1]
+	vm.sp -= 1
+	return obj
+}
+
+func (vm *VM) global(index int) object.Object {
+	if obj := vm.globals[index]; obj != nil {
+		return obj
+	}
+
+	name := vm.globalNames[index]
+	if builtin, ok := vm.builtins[name]; ok {
+		return builtin
+	}
+	return newError("identifier not found: " + name)
+}
+
+func (vm *VM) assignGlobal(index int, value object.Object) object.Object {
+	if vm.globals[index] == nil {
+		return newError("assignment to undeclared identifier: " + vm.globalNames[index])
+	}
+	vm.globals[index] = value
+	return nil
+}
+
+// localCell returns the cell of the local variable in the stack slot at
+// index. The variable is moved into a new cell when it is first captured.
+func (vm *VM) localCell(index int) *object.Cell {
+	if cell, ok := vm.stack[index].(*object.Cell); ok {
+		return cell
+	}
+	cell := &object.Cell{Value: vm.stack[index]}
+	vm.stack[index] = cell
+	return cell
+}
+
+// setPairs sets the keys and values in the stack slots from startIndex to
+// endIndex in hash.
+func (vm *VM) setPairs(hash *object.Hash, startIndex, endIndex int) object.Object {
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		if _, ok := key.(object.Hasher); !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(key, value)
+	}
+	return nil
+}
+
+func (vm *VM) executeCall(numArgs int) object.Object {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return newError("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) object.Object {
+	if numArgs != cl.Fn.NumParameters {
+		return newError(
+			"wrong number of arguments. got=%d, want=%d",
+			numArgs, cl.Fn.NumParameters,
+		)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+	vm.reserve(cl.Fn.NumLocals - numArgs)
+
+	// Clear the slots of the local variables, which may still hold the
+	// cells of an earlier call.
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	clear(vm.stack[frame.basePointer+numArgs : vm.sp])
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) object.Object {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	var result object.Object
+	if builtin.HigherOrderFn != nil {
+		result = vm.allocate(builtin.HigherOrderFn(vm.callFunction, args...))
+	} else {
+		result = vm.allocate(builtin.Fn(args...))
+	}
+	vm.sp = vm.sp - numArgs - 1
+
+	if result == nil {
+		result = NULL
+	}
+	return vm.pushResult(result)
+}
+
+// callFunction calls fn with args for a higher-order builtin. It runs
+// the called function to its end before it returns the result.
+func (vm *VM) callFunction(fn object.Object, args ...object.Object) object.Object {
+	depth, sp := vm.framesIndex, vm.sp
+
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+
+	result := vm.executeCall(len(args))
+	if result == nil {
+		result = vm.execute(depth)
+	}
+	if result != nil {
+		vm.framesIndex, vm.sp = depth, sp
+		return result
+	}
+	return vm.pop()
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) object.Object {
+	function, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return newError("not a function: %+v", vm.constants[constIndex])
+	}
+
+	free := make([]*object.Cell, numFree)
+	for i, value := range vm.stack[vm.sp-numFree : vm.sp] {
+		if cell, ok := value.(*object.Cell); ok {
+			free[i] = cell
+		} else {
+			free[i] = &object.Cell{Value: value}
+		}
+	}
+	vm.sp = vm.sp - numFree
+
+	return vm.pushResult(vm.allocate(&object.Closure{Fn: function, Free: free}))
+}
+
+// iterNext pushes the next values of the iterator on top of the stack or
+// jumps to pos when it is done.
+func (vm *VM) iterNext(pos int, numValues int) object.Object {
+	iterator := vm.pop().(*evaluator.Iterator)
+
+	key, value, ok := iterator.Next(numValues == 2)
+	if !ok {
+		vm.currentFrame().ip = pos - 1
+		return nil
+	}
+
+	if numValues == 2 {
+		vm.push(key)
+	}
+	vm.push(value)
+	return nil
+}
+
+func (vm *VM) pushQuote(constIndex int, numValues int) object.Object {
+	quote := vm.constants[constIndex].(*object.Quote)
+
+	values := vm.stack[vm.sp-numValues : vm.sp]
+	node, err := evaluator.Unquote(quote.Node, func(ast.Expression) object.Object {
+		value := values[0]
+		values = values[1:]
+		return value
+	})
+	vm.sp = vm.sp - numValues
+
+	if err != nil {
+		return err
+	}
+	vm.push(&object.Quote{Node: node})
+	return nil
+}
+
+func newError(format string, args ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, args...)}
+}
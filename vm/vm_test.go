@@ -0,0 +1,65 @@
+package vm
+
+import (
+	"context"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+// Most of the vm is tested by running the evaluator tests against it. The
+// tests here cover what is specific to the vm.
+
+func TestGlobalsStore(t *testing.T) {
+	inputs := []string{"let a = 1;", "let b = a + 1;", "a + b"}
+
+	globals := make([]object.Object, GlobalSize)
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+
+	var result object.Object
+	for _, input := range inputs {
+		program := parser.New(lexer.New(input)).ParseProgram()
+
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		result = NewWithGlobalsStore(bytecode, globals).Run(context.Background())
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 3 {
+		t.Errorf("wrong result. want=3, got=%+v", result)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	input := "let f = fn(x) { f(x + 1) }; f(0);"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	result := New(comp.Bytecode()).Run(context.Background())
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", result, result)
+	}
+
+	if errObj.Message != "stack overflow" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	if len(errObj.Trace) != MaxFrames {
+		t.Errorf("wrong trace length. want=%d, got=%d", MaxFrames, len(errObj.Trace))
+	}
+}